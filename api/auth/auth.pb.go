@@ -126,7 +126,9 @@ type RegisterPublicKeyRequest struct {
 	// The role of the public key. When skip_user_role is true, this field is ignored.
 	Role string `protobuf:"bytes,5,opt,name=role,proto3" json:"role,omitempty"`
 	// If true, the role field will be used to determine the role of the public key.
-	SkipUserRole  bool `protobuf:"varint,6,opt,name=skip_user_role,json=skipUserRole,proto3" json:"skip_user_role,omitempty"`
+	SkipUserRole bool `protobuf:"varint,6,opt,name=skip_user_role,json=skipUserRole,proto3" json:"skip_user_role,omitempty"`
+	// The URL of the client loopback listener to redirect the browser to once the public key is confirmed.
+	CallbackUrl   string `protobuf:"bytes,7,opt,name=callback_url,json=callbackUrl,proto3" json:"callback_url,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -189,6 +191,13 @@ func (x *RegisterPublicKeyRequest) GetSkipUserRole() bool {
 	return false
 }
 
+func (x *RegisterPublicKeyRequest) GetCallbackUrl() string {
+	if x != nil {
+		return x.CallbackUrl
+	}
+	return ""
+}
+
 type RegisterPublicKeyResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	LoginUrl      string                 `protobuf:"bytes,1,opt,name=login_url,json=loginUrl,proto3" json:"login_url,omitempty"`
@@ -382,13 +391,14 @@ const file_auth_auth_proto_rawDesc = "" +
 	"\bpgp_data\x18\x01 \x01(\fR\apgpData\x12#\n" +
 	"\rwebauthn_data\x18\x02 \x01(\fR\fwebauthnData\" \n" +
 	"\bIdentity\x12\x14\n" +
-	"\x05email\x18\x01 \x01(\tR\x05email\"\xbc\x01\n" +
+	"\x05email\x18\x01 \x01(\tR\x05email\"\xdf\x01\n" +
 	"\x18RegisterPublicKeyRequest\x12.\n" +
 	"\n" +
 	"public_key\x18\x01 \x01(\v2\x0f.auth.PublicKeyR\tpublicKey\x12*\n" +
 	"\bidentity\x18\x02 \x01(\v2\x0e.auth.IdentityR\bidentity\x12\x12\n" +
 	"\x04role\x18\x05 \x01(\tR\x04role\x12$\n" +
-	"\x0eskip_user_role\x18\x06 \x01(\bR\fskipUserRoleJ\x04\b\x03\x10\x04J\x04\b\x04\x10\x05\"\\\n" +
+	"\x0eskip_user_role\x18\x06 \x01(\bR\fskipUserRole\x12!\n" +
+	"\fcallback_url\x18\a \x01(\tR\vcallbackUrlJ\x04\b\x03\x10\x04J\x04\b\x04\x10\x05\"\\\n" +
 	"\x19RegisterPublicKeyResponse\x12\x1b\n" +
 	"\tlogin_url\x18\x01 \x01(\tR\bloginUrl\x12\"\n" +
 	"\rpublic_key_id\x18\x02 \x01(\tR\vpublicKeyId\"G\n" +
@@ -72,6 +72,7 @@ func (m *RegisterPublicKeyRequest) CloneVT() *RegisterPublicKeyRequest {
 	r.Identity = m.Identity.CloneVT()
 	r.Role = m.Role
 	r.SkipUserRole = m.SkipUserRole
+	r.CallbackUrl = m.CallbackUrl
 	if len(m.unknownFields) > 0 {
 		r.unknownFields = make([]byte, len(m.unknownFields))
 		copy(r.unknownFields, m.unknownFields)
@@ -211,6 +212,9 @@ func (this *RegisterPublicKeyRequest) EqualVT(that *RegisterPublicKeyRequest) bo
 	if this.SkipUserRole != that.SkipUserRole {
 		return false
 	}
+	if this.CallbackUrl != that.CallbackUrl {
+		return false
+	}
 	return string(this.unknownFields) == string(that.unknownFields)
 }
 
@@ -417,6 +421,13 @@ func (m *RegisterPublicKeyRequest) MarshalToSizedBufferVT(dAtA []byte) (int, err
 		i -= len(m.unknownFields)
 		copy(dAtA[i:], m.unknownFields)
 	}
+	if len(m.CallbackUrl) > 0 {
+		i -= len(m.CallbackUrl)
+		copy(dAtA[i:], m.CallbackUrl)
+		i = protohelpers.EncodeVarint(dAtA, i, uint64(len(m.CallbackUrl)))
+		i--
+		dAtA[i] = 0x3a
+	}
 	if m.SkipUserRole {
 		i--
 		if m.SkipUserRole {
@@ -677,6 +688,10 @@ func (m *RegisterPublicKeyRequest) SizeVT() (n int) {
 	if m.SkipUserRole {
 		n += 2
 	}
+	l = len(m.CallbackUrl)
+	if l > 0 {
+		n += 1 + l + protohelpers.SizeOfVarint(uint64(l))
+	}
 	n += len(m.unknownFields)
 	return n
 }
@@ -1096,6 +1111,38 @@ func (m *RegisterPublicKeyRequest) UnmarshalVT(dAtA []byte) error {
 				}
 			}
 			m.SkipUserRole = bool(v != 0)
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CallbackUrl", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return protohelpers.ErrIntOverflow
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return protohelpers.ErrInvalidLength
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return protohelpers.ErrInvalidLength
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.CallbackUrl = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := protohelpers.Skip(dAtA[iNdEx:])
@@ -44,6 +44,14 @@ func WithSkipUserRole(skipUserRole bool) RegisterPGPPublicKeyOption {
 	}
 }
 
+// WithCallbackURL sets the callback URL in the authpb.RegisterPublicKeyRequest.
+// The browser is redirected to it once the public key is confirmed.
+func WithCallbackURL(callbackURL string) RegisterPGPPublicKeyOption {
+	return func(o *authpb.RegisterPublicKeyRequest) {
+		o.CallbackUrl = callbackURL
+	}
+}
+
 // RegisterPGPPublicKey registers a PGP public key for the given identity and returns the login URL.
 // Registered public key will need to be verified before it can be used for signing.
 func (client *Client) RegisterPGPPublicKey(ctx context.Context, email string, publicKey []byte, opt ...RegisterPGPPublicKeyOption) (string, error) {
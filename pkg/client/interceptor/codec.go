@@ -0,0 +1,55 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package interceptor
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+// signedCall is the signer of the call, and the encoding of its request.
+type signedCall struct {
+	signer   message.Signer
+	codec    *requestCodec
+	identity string
+}
+
+// callOptions returns the call options which send the signed encoding of the request.
+func (call *signedCall) callOptions() []grpc.CallOption {
+	if call == nil || call.codec == nil {
+		return nil
+	}
+
+	return []grpc.CallOption{grpc.ForceCodecV2(call.codec)}
+}
+
+// requestCodec wraps the proto codec to send the request with the given encoding, see message.GRPC.RequestData.
+type requestCodec struct {
+	encoding.CodecV2
+
+	request any
+	data    []byte
+}
+
+func newRequestCodec(request any, data []byte) *requestCodec {
+	return &requestCodec{
+		CodecV2: encoding.GetCodecV2(proto.Name),
+		request: request,
+		data:    data,
+	}
+}
+
+// Marshal implements encoding.CodecV2.
+func (c *requestCodec) Marshal(v any) (mem.BufferSlice, error) {
+	if v != c.request {
+		return c.CodecV2.Marshal(v)
+	}
+
+	return mem.BufferSlice{mem.SliceBuffer(c.data)}, nil
+}
@@ -12,12 +12,14 @@ import (
 	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/pkg/browser"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/siderolabs/go-api-signature/pkg/message"
 	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
@@ -38,6 +40,14 @@ type AuthEnabledFunc func(ctx context.Context, cc *grpc.ClientConn) (bool, error
 // UserKeyFunc is a function that is called to read the initial user (non-service-account) key.
 type UserKeyFunc func(ctx context.Context, cc *grpc.ClientConn, options *Options) (message.Signer, error)
 
+// KeyExpiringFunc is called before the proactive renewal of the user key which expires at the given time.
+type KeyExpiringFunc func(ctx context.Context, signer message.Signer, expiresAt time.Time)
+
+// expiringSigner is implemented by the signers which expire, e.g. pgp.Key.
+type expiringSigner interface {
+	Expiration() (time.Time, bool)
+}
+
 // Options are the options for the interceptor.
 type Options struct {
 	InfoWriter       io.Writer
@@ -45,15 +55,44 @@ type Options struct {
 	GetUserKeyFunc   UserKeyFunc
 	RenewUserKeyFunc UserKeyFunc
 
+	// KeyExpiringFunc is called before the user key is renewed proactively, e.g. to warn the user.
+	//
+	// By default, a message is printed to InfoWriter.
+	KeyExpiringFunc KeyExpiringFunc
+
 	UserKeyProvider *client.KeyProvider
 
 	ContextName string
 	Identity    string
 	ClientName  string
 
+	// SignatureVersion is the version of the request signatures, message.SignatureVersionV1 is used by default.
+	//
+	// With message.SignatureVersionV2, unary request messages are covered by the signature.
+	SignatureVersion message.SignatureVersion
+
+	// MessageOptions are passed to message.NewGRPC on signing, e.g. message.WithAdditionalSignedHeaders.
+	MessageOptions []message.Option
+
 	// ServiceAccountBase64 is a static service account key in base64 format.
 	// When specified, ContextName and Identity are ignored and retries are never attempted.
 	ServiceAccountBase64 string
+
+	// DeviceCode configures the device code flow, if it is selected with RenewUserKeyFunc: RenewUserKeyViaDeviceCode.
+	//
+	// It also configures the confirmation polls after the redirect of RenewUserKeyViaLoopback.
+	DeviceCode DeviceCodeOptions
+
+	// RenewBeforeExpiry enables the proactive renewal of the user key if it expires within the given duration.
+	//
+	// The key is checked before signing each request, and renewed before the request is sent.
+	// If the renewal fails, the current key is used until it expires.
+	RenewBeforeExpiry time.Duration
+
+	// SignStreamMessages enables signing of each message sent on the signed streams, see message.StreamSigner.
+	//
+	// The messages carry the signed envelope, which is only verified by the servers with the stream message verification enabled.
+	SignStreamMessages bool
 }
 
 // Interceptor is a GRPC interceptor that provides Unary and Stream client interceptors.
@@ -61,10 +100,20 @@ type Interceptor struct {
 	userSigner     message.Signer
 	initErr        error
 	serviceAccount *serviceaccount.ServiceAccount
-	options        Options
-	initOnce       sync.Once
-	userSignerLock sync.Mutex
-	authEnabled    bool
+	// userKeyRenewal is the in-flight user key renewal, it is shared by the concurrent callers.
+	userKeyRenewal *userKeyRenewal
+	// renewalFailedFingerprint is the fingerprint of the user key which failed the proactive renewal, it is not renewed proactively again.
+	renewalFailedFingerprint string
+	options                  Options
+	initOnce                 sync.Once
+	userSignerLock           sync.Mutex
+	authEnabled              bool
+}
+
+// userKeyRenewal is a user key renewal shared by the concurrent callers.
+type userKeyRenewal struct {
+	err  error
+	done chan struct{}
 }
 
 // New creates a new client interceptor.
@@ -89,6 +138,15 @@ func New(options Options) *Interceptor {
 		options.RenewUserKeyFunc = renewUserKeyViaAuthFlow
 	}
 
+	if options.KeyExpiringFunc == nil {
+		infoWriter := options.InfoWriter
+
+		options.KeyExpiringFunc = func(_ context.Context, signer message.Signer, expiresAt time.Time) {
+			//nolint:errcheck
+			fmt.Fprintf(infoWriter, "Key %s expires in %s, renewing\n", signer.Fingerprint(), time.Until(expiresAt).Round(time.Second))
+		}
+	}
+
 	return &Interceptor{
 		options: options,
 	}
@@ -97,8 +155,8 @@ func New(options Options) *Interceptor {
 // Unary returns a new unary client interceptor which signs requests.
 func (i *Interceptor) Unary() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		return i.intercept(ctx, cc, method, func(ctx context.Context) error {
-			return invoker(ctx, method, req, reply, cc, opts...)
+		return i.intercept(ctx, cc, method, req, func(ctx context.Context, call *signedCall) error {
+			return invoker(ctx, method, req, reply, cc, append(opts, call.callOptions()...)...)
 		})
 	}
 }
@@ -108,12 +166,26 @@ func (i *Interceptor) Stream() grpc.StreamClientInterceptor {
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
 		var stream grpc.ClientStream
 
-		err := i.intercept(ctx, cc, method, func(ctx context.Context) error {
-			var streamErr error
+		err := i.intercept(ctx, cc, method, nil, func(ctx context.Context, call *signedCall) error {
+			// the stream signer is created before the stream is opened, so that the stream is not leaked on errors
+			streamSigner, streamErr := i.newStreamSigner(ctx, method, call)
+			if streamErr != nil {
+				return streamErr
+			}
 
 			stream, streamErr = streamer(ctx, desc, cc, method, opts...)
+			if streamErr != nil {
+				return streamErr
+			}
+
+			if streamSigner != nil {
+				stream = &clientStream{
+					ClientStream: stream,
+					signer:       streamSigner,
+				}
+			}
 
-			return streamErr
+			return nil
 		})
 		if err != nil {
 			return nil, err
@@ -123,9 +195,33 @@ func (i *Interceptor) Stream() grpc.StreamClientInterceptor {
 	}
 }
 
-func (i *Interceptor) intercept(ctx context.Context, cc *grpc.ClientConn, method string, fn func(context.Context) error) error {
+// newStreamSigner creates the signer of the stream messages, if stream message signing is enabled and the stream is signed.
+//
+// The messages are signed with the same key as the request metadata. It returns nil if the messages should not be signed.
+func (i *Interceptor) newStreamSigner(ctx context.Context, method string, call *signedCall) (*message.StreamSigner, error) {
+	if !i.options.SignStreamMessages || call == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok || len(md.Get(message.SignatureHeaderKey)) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	streamSigner, err := message.NewStreamSigner(message.NewGRPC(md, method, i.options.MessageOptions...), call.identity, call.signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream signer: %w", err)
+	}
+
+	return streamSigner, nil
+}
+
+// intercept signs the call and runs fn with the signed context, retrying it once after the user key renewal.
+//
+// If the call is not signed, fn is called with a nil signedCall.
+func (i *Interceptor) intercept(ctx context.Context, cc *grpc.ClientConn, method string, req any, fn func(context.Context, *signedCall) error) error {
 	if ctx.Value(SkipInterceptorContextKey{}) != nil {
-		return fn(ctx)
+		return fn(ctx, nil)
 	}
 
 	ctx = context.WithValue(ctx, SkipInterceptorContextKey{}, struct{}{})
@@ -135,19 +231,24 @@ func (i *Interceptor) intercept(ctx context.Context, cc *grpc.ClientConn, method
 	}
 
 	if !i.authEnabled {
-		return fn(ctx)
+		return fn(ctx, nil)
 	}
 
 	unsignedCtx := ctx
 	isRetryable := i.serviceAccount == nil
 
+	// usedFingerprint is the fingerprint of the user key which signed the last attempt
+	var usedFingerprint string
+
 	signAndMakeCall := func() (bool, error) {
-		signedCtx, err := i.sign(unsignedCtx, cc, method)
+		signedCtx, call, err := i.sign(unsignedCtx, cc, method, req)
 		if err != nil {
 			return isRetryable, err
 		}
 
-		err = fn(signedCtx)
+		usedFingerprint = call.signer.Fingerprint()
+
+		err = fn(signedCtx, call)
 		if err != nil {
 			return status.Code(err) == codes.Unauthenticated && isRetryable, err
 		}
@@ -167,7 +268,7 @@ func (i *Interceptor) intercept(ctx context.Context, cc *grpc.ClientConn, method
 
 		fmt.Fprintf(i.options.InfoWriter, "Could not authenticate: %v\n", err) //nolint:errcheck
 
-		if err = i.renewUser(ctx, cc); err != nil {
+		if err = i.renewUser(ctx, cc, usedFingerprint, nil); err != nil {
 			return err
 		}
 
@@ -175,49 +276,179 @@ func (i *Interceptor) intercept(ctx context.Context, cc *grpc.ClientConn, method
 	}
 }
 
-func (i *Interceptor) renewUser(ctx context.Context, cc *grpc.ClientConn) error {
-	newSigner, err := i.options.RenewUserKeyFunc(ctx, cc, &i.options)
-	if err != nil {
-		return err
+// RenewUserKey runs the user key renewal flow and replaces the signer used by the interceptor.
+//
+// It allows other transports (e.g. the signing HTTP transport) to share the key renewal flow with the interceptor.
+// If a renewal is already in progress, its result is returned instead of running another one.
+func (i *Interceptor) RenewUserKey(ctx context.Context, cc *grpc.ClientConn) (message.Signer, error) {
+	var staleFingerprint string
+
+	i.userSignerLock.Lock()
+
+	if i.userSigner != nil {
+		staleFingerprint = i.userSigner.Fingerprint()
 	}
 
-	i.setUserSigner(newSigner)
+	i.userSignerLock.Unlock()
 
-	return nil
+	if err := i.renewUser(ctx, cc, staleFingerprint, nil); err != nil {
+		return nil, err
+	}
+
+	i.userSignerLock.Lock()
+	defer i.userSignerLock.Unlock()
+
+	return i.userSigner, nil
+}
+
+// renewUser renews the user key, coalescing the concurrent renewals into a single auth flow.
+//
+// If staleFingerprint is set, and the current user key has a different fingerprint, the key was already renewed
+// by another caller, so it is not renewed again.
+// If a renewal is in progress, the caller waits for it and gets its result.
+// onStart is only called if the caller starts a new renewal.
+func (i *Interceptor) renewUser(ctx context.Context, cc *grpc.ClientConn, staleFingerprint string, onStart func()) error {
+	i.userSignerLock.Lock()
+
+	if staleFingerprint != "" && i.userSigner != nil && i.userSigner.Fingerprint() != staleFingerprint {
+		i.userSignerLock.Unlock()
+
+		return nil
+	}
+
+	if renewal := i.userKeyRenewal; renewal != nil {
+		i.userSignerLock.Unlock()
+
+		select {
+		case <-renewal.done:
+			return renewal.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	renewal := &userKeyRenewal{
+		done: make(chan struct{}),
+	}
+
+	i.userKeyRenewal = renewal
+
+	i.userSignerLock.Unlock()
+
+	if onStart != nil {
+		onStart()
+	}
+
+	// the stale key is not re-read from the store by the flow, as it might be already replaced by the unconfirmed key of another process
+	newSigner, err := i.options.RenewUserKeyFunc(context.WithValue(ctx, staleFingerprintContextKey{}, staleFingerprint), cc, &i.options)
+
+	i.userSignerLock.Lock()
+
+	if err == nil {
+		i.userSigner = newSigner
+	}
+
+	renewal.err = err
+	i.userKeyRenewal = nil
+
+	i.userSignerLock.Unlock()
+
+	close(renewal.done)
+
+	return err
 }
 
-func (i *Interceptor) sign(ctx context.Context, cc *grpc.ClientConn, method string) (context.Context, error) {
+func (i *Interceptor) sign(ctx context.Context, cc *grpc.ClientConn, method string, req any) (context.Context, *signedCall, error) {
 	md, ok := metadata.FromOutgoingContext(ctx)
 	if !ok {
 		md = metadata.New(nil)
 	}
 
-	msg := message.NewGRPC(md, method)
+	msg := message.NewGRPC(md, method, append([]message.Option{message.WithSignatureVersion(i.options.SignatureVersion)}, i.options.MessageOptions...)...)
 
-	var (
-		identity string
-		signer   message.Signer
-	)
+	call := &signedCall{}
 
-	if i.serviceAccount != nil {
-		identity = i.serviceAccount.Name
-		signer = i.serviceAccount.Key
-	} else {
-		identity = i.options.Identity
+	if protoReq, isProto := req.(proto.Message); isProto {
+		msg.Request = protoReq
 
-		var err error
+		// the request is marshaled once, so that the signature covers the sent encoding, see message.GRPC.RequestData
+		if i.options.SignatureVersion == message.SignatureVersionV2 {
+			requestData, err := proto.Marshal(protoReq)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to marshal request: %w", err)
+			}
 
-		signer, err = i.initAndGetUserSigner(ctx, cc)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get signer: %w", err)
+			msg.RequestData = requestData
+			call.codec = newRequestCodec(protoReq, requestData)
 		}
 	}
 
-	if err := msg.Sign(identity, signer); err != nil {
-		return nil, fmt.Errorf("failed to sign message: %w", err)
+	var err error
+
+	call.identity, call.signer, err = i.getSigner(ctx, cc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = msg.Sign(call.identity, call.signer); err != nil {
+		return nil, nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	return metadata.NewOutgoingContext(ctx, msg.Metadata), call, nil
+}
+
+// getSigner returns the identity and the signer of the service account if it is configured, or of the user otherwise.
+func (i *Interceptor) getSigner(ctx context.Context, cc *grpc.ClientConn) (string, message.Signer, error) {
+	if i.serviceAccount != nil {
+		return i.serviceAccount.Name, i.serviceAccount.Key, nil
+	}
+
+	signer, err := i.initAndGetUserSigner(ctx, cc)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get signer: %w", err)
+	}
+
+	return i.options.Identity, i.renewExpiringUserSigner(ctx, cc, signer), nil
+}
+
+// renewExpiringUserSigner renews the user key if it expires within Options.RenewBeforeExpiry, and returns the signer to use.
+func (i *Interceptor) renewExpiringUserSigner(ctx context.Context, cc *grpc.ClientConn, signer message.Signer) message.Signer {
+	if i.options.RenewBeforeExpiry <= 0 {
+		return signer
+	}
+
+	expiring, ok := signer.(expiringSigner)
+	if !ok {
+		return signer
+	}
+
+	expiresAt, expires := expiring.Expiration()
+	if !expires || time.Until(expiresAt) > i.options.RenewBeforeExpiry {
+		return signer
+	}
+
+	i.userSignerLock.Lock()
+	renewalFailed := i.renewalFailedFingerprint == signer.Fingerprint()
+	i.userSignerLock.Unlock()
+
+	if renewalFailed {
+		return signer
+	}
+
+	if err := i.renewUser(ctx, cc, signer.Fingerprint(), func() { i.options.KeyExpiringFunc(ctx, signer, expiresAt) }); err != nil {
+		fmt.Fprintf(i.options.InfoWriter, "Could not renew the key: %v\n", err) //nolint:errcheck
+
+		i.userSignerLock.Lock()
+		i.renewalFailedFingerprint = signer.Fingerprint()
+		i.userSignerLock.Unlock()
+
+		return signer
 	}
 
-	return metadata.NewOutgoingContext(ctx, msg.Metadata), nil
+	i.userSignerLock.Lock()
+	defer i.userSignerLock.Unlock()
+
+	return i.userSigner
 }
 
 func (i *Interceptor) initAndGetUserSigner(ctx context.Context, cc *grpc.ClientConn) (message.Signer, error) {
@@ -318,3 +549,25 @@ func (i *Interceptor) initServiceAccount() (bool, error) {
 
 	return false, nil
 }
+
+// clientStream wraps grpc.ClientStream to sign each sent message.
+type clientStream struct {
+	grpc.ClientStream
+
+	signer *message.StreamSigner
+}
+
+// SendMsg signs the message and sends it.
+func (s *clientStream) SendMsg(m any) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to sign stream message: unsupported message type %T", m)
+	}
+
+	signed, err := s.signer.Sign(msg)
+	if err != nil {
+		return fmt.Errorf("failed to sign stream message: %w", err)
+	}
+
+	return s.ClientStream.SendMsg(signed)
+}
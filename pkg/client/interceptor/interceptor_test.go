@@ -7,8 +7,12 @@ package interceptor_test
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -20,6 +24,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"github.com/siderolabs/go-api-signature/pkg/client/interceptor"
+	"github.com/siderolabs/go-api-signature/pkg/internal/grpctest"
 	"github.com/siderolabs/go-api-signature/pkg/message"
 )
 
@@ -35,6 +40,16 @@ func (t *testSigner) Sign(data []byte) ([]byte, error) {
 	return []byte(t.id + " " + string(data)), nil
 }
 
+type expiringTestSigner struct {
+	testSigner
+
+	expiresAt time.Time
+}
+
+func (t *expiringTestSigner) Expiration() (time.Time, bool) {
+	return t.expiresAt, true
+}
+
 type testServer struct {
 	grpc_testing.UnimplementedTestServiceServer
 	t *testing.T
@@ -97,7 +112,7 @@ type SignatureTestSuite struct {
 
 	clientConn *grpc.ClientConn
 
-	GRPCSuite
+	grpctest.Suite
 }
 
 func (suite *SignatureTestSuite) SetupSuite() {
@@ -177,6 +192,139 @@ func (suite *SignatureTestSuite) TestStreamFirstAttempt() {
 	suite.Assert().Equal("valid-signature-1", string(response.Payload.Body))
 }
 
+// TestUnaryRenewBeforeExpiry tests the proactive renewal of the expiring key.
+func (suite *SignatureTestSuite) TestUnaryRenewBeforeExpiry() {
+	for _, tt := range []struct {
+		name             string
+		body             string
+		expectedResponse string
+		expiresIn        time.Duration
+		expectRenewal    bool
+	}{
+		{
+			name:             "expiring",
+			expiresIn:        5 * time.Minute,
+			expectedResponse: "valid-signature-2",
+			expectRenewal:    true,
+		},
+		{
+			name:             "valid",
+			expiresIn:        time.Hour,
+			body:             "accept-signature-1",
+			expectedResponse: "valid-signature-1",
+		},
+	} {
+		suite.Run(tt.name, func() {
+			var expiringCalls, renewCalls int
+
+			clientInterceptor := interceptor.New(interceptor.Options{
+				GetUserKeyFunc: func(context.Context, *grpc.ClientConn, *interceptor.Options) (message.Signer, error) {
+					return &expiringTestSigner{
+						testSigner: testSigner{id: "signer-1"},
+						expiresAt:  time.Now().Add(tt.expiresIn),
+					}, nil
+				},
+				RenewUserKeyFunc: func(context.Context, *grpc.ClientConn, *interceptor.Options) (message.Signer, error) {
+					renewCalls++
+
+					return &testSigner{id: "signer-2"}, nil
+				},
+				KeyExpiringFunc: func(_ context.Context, signer message.Signer, expiresAt time.Time) {
+					expiringCalls++
+
+					suite.Assert().Equal("signer-1", signer.Fingerprint())
+					suite.Assert().WithinDuration(time.Now().Add(tt.expiresIn), expiresAt, time.Minute)
+				},
+				Identity:          "test@example.org",
+				RenewBeforeExpiry: 10 * time.Minute,
+			})
+
+			clientConn, err := grpc.NewClient(suite.Target,
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
+			)
+			suite.Require().NoError(err)
+
+			defer clientConn.Close() //nolint:errcheck
+
+			for range 2 {
+				response, err := grpc_testing.NewTestServiceClient(clientConn).UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{
+					Payload: &grpc_testing.Payload{
+						Body: []byte(tt.body),
+					},
+				})
+				suite.Require().NoError(err)
+
+				suite.Assert().Equal(tt.expectedResponse, string(response.Payload.Body))
+			}
+
+			if tt.expectRenewal {
+				suite.Assert().Equal(1, renewCalls)
+				suite.Assert().Equal(1, expiringCalls)
+			} else {
+				suite.Assert().Zero(renewCalls)
+				suite.Assert().Zero(expiringCalls)
+			}
+		})
+	}
+}
+
+// TestUnaryConcurrentRenewal tests that the renewals of the concurrent failed calls are coalesced.
+func (suite *SignatureTestSuite) TestUnaryConcurrentRenewal() {
+	var renewCalls atomic.Int32
+
+	clientInterceptor := interceptor.New(interceptor.Options{
+		GetUserKeyFunc: func(context.Context, *grpc.ClientConn, *interceptor.Options) (message.Signer, error) {
+			return &testSigner{id: "signer-1"}, nil
+		},
+		RenewUserKeyFunc: func(context.Context, *grpc.ClientConn, *interceptor.Options) (message.Signer, error) {
+			renewCalls.Add(1)
+
+			// give the other calls time to fail and wait for the renewal
+			time.Sleep(100 * time.Millisecond)
+
+			return &testSigner{id: "signer-2"}, nil
+		},
+		Identity:   "test@example.org",
+		InfoWriter: io.Discard,
+	})
+
+	clientConn, err := grpc.NewClient(suite.Target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
+	)
+	suite.Require().NoError(err)
+
+	defer clientConn.Close() //nolint:errcheck
+
+	client := grpc_testing.NewTestServiceClient(clientConn)
+
+	const numCalls = 20
+
+	var wg sync.WaitGroup
+
+	responses := make([]string, numCalls)
+	errs := make([]error, numCalls)
+
+	for i := range numCalls {
+		wg.Go(func() {
+			response, callErr := client.UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{})
+
+			errs[i] = callErr
+			responses[i] = string(response.GetPayload().GetBody())
+		})
+	}
+
+	wg.Wait()
+
+	for i := range numCalls {
+		suite.Require().NoError(errs[i])
+		suite.Assert().Equal("valid-signature-2", responses[i])
+	}
+
+	suite.Assert().EqualValues(1, renewCalls.Load())
+}
+
 func TestSignatureTestSuite(t *testing.T) {
 	suite.Run(t, new(SignatureTestSuite))
 }
@@ -6,46 +6,208 @@ package interceptor
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/browser"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/siderolabs/go-api-signature/pkg/client/auth"
 	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
 )
 
+// Device code flow defaults.
+const (
+	DefaultDeviceCodePollInterval    = 10 * time.Second
+	DefaultDeviceCodeMaxPollInterval = time.Minute
+	DefaultDeviceCodeTimeout         = 15 * time.Minute
+)
+
+// DeviceCodeOptions are the options of the device code flow, see RenewUserKeyViaDeviceCode.
+//
+// Zero values are replaced with the defaults.
+type DeviceCodeOptions struct {
+	// PollInterval is the initial interval of the confirmation polls.
+	PollInterval time.Duration
+
+	// MaxPollInterval is the upper bound of the poll interval on the transient errors.
+	MaxPollInterval time.Duration
+
+	// Timeout is the total time to wait for the confirmation.
+	Timeout time.Duration
+}
+
+func (o DeviceCodeOptions) pollInterval() time.Duration {
+	if o.PollInterval > 0 {
+		return o.PollInterval
+	}
+
+	return DefaultDeviceCodePollInterval
+}
+
+func (o DeviceCodeOptions) maxPollInterval() time.Duration {
+	if o.MaxPollInterval > 0 {
+		return max(o.MaxPollInterval, o.pollInterval())
+	}
+
+	return max(DefaultDeviceCodeMaxPollInterval, o.pollInterval())
+}
+
+func (o DeviceCodeOptions) timeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+
+	return DefaultDeviceCodeTimeout
+}
+
 func renewUserKeyViaAuthFlow(ctx context.Context, cc *grpc.ClientConn, options *Options) (message.Signer, error) {
+	return renewUserKeyLocked(ctx, cc, options, authFlow)
+}
+
+func authFlow(ctx context.Context, cc *grpc.ClientConn, options *Options) (*client.Key, error) {
 	ctx = context.WithValue(ctx, SkipInterceptorContextKey{}, struct{}{})
 
 	authCli := auth.NewClient(cc)
 
-	err := options.UserKeyProvider.DeleteKey(options.ContextName, options.Identity)
-	if err != nil && !os.IsNotExist(err) {
+	pgpKey, loginURL, savePath, err := registerNewUserKey(ctx, authCli, options)
+	if err != nil {
 		return nil, err
 	}
 
-	pgpKey, err := options.UserKeyProvider.GenerateKey(options.ContextName, options.Identity, options.ClientName)
+	openLoginURL(loginURL)
+
+	publicKeyID := pgpKey.Fingerprint()
+
+	err = authCli.AwaitPublicKeyConfirmation(ctx, publicKeyID)
 	if err != nil {
 		return nil, err
 	}
 
-	publicKey, err := pgpKey.ArmorPublic()
+	printKeyRegistered(options, publicKeyID, savePath)
+
+	return pgpKey, nil
+}
+
+// RenewUserKeyViaLoopback is a UserKeyFunc which renews the user key using the browser flow with a loopback redirect.
+//
+// A localhost HTTP listener is started, and its callback URL is passed on the key registration,
+// so the flow completes as soon as the browser is redirected back after the confirmation.
+// The callback is verified with the AwaitPublicKeyConfirmation polls configured by DeviceCode, as it can be forged by any local process.
+// If the listener can't be started, or the server doesn't redirect, the flow falls back to AwaitPublicKeyConfirmation.
+func RenewUserKeyViaLoopback(ctx context.Context, cc *grpc.ClientConn, options *Options) (message.Signer, error) {
+	return renewUserKeyLocked(ctx, cc, options, loopbackFlow)
+}
+
+func loopbackFlow(ctx context.Context, cc *grpc.ClientConn, options *Options) (*client.Key, error) {
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintf(options.InfoWriter, "Could not start the loopback listener, waiting for the confirmation instead: %v\n", err) //nolint:errcheck
+
+		return authFlow(ctx, cc, options)
+	}
+
+	defer listener.Close() //nolint:errcheck
+
+	ctx = context.WithValue(ctx, SkipInterceptorContextKey{}, struct{}{})
+
+	authCli := auth.NewClient(cc)
+
+	callbackPath, err := randomCallbackPath()
 	if err != nil {
 		return nil, err
 	}
 
-	loginURL, err := authCli.RegisterPGPPublicKey(ctx, options.Identity, []byte(publicKey))
+	redirected := make(chan struct{})
+
+	server := &http.Server{
+		Handler:           loopbackHandler(callbackPath, redirected),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go server.Serve(listener) //nolint:errcheck
+
+	defer server.Close() //nolint:errcheck
+
+	callbackURL := "http://" + listener.Addr().String() + callbackPath
+
+	pgpKey, loginURL, savePath, err := registerNewUserKey(ctx, authCli, options, auth.WithCallbackURL(callbackURL))
 	if err != nil {
 		return nil, err
 	}
 
-	savePath, err := options.UserKeyProvider.WriteKey(pgpKey)
+	openLoginURL(loginURL)
+
+	publicKeyID := pgpKey.Fingerprint()
+
+	awaitCtx, awaitCancel := context.WithCancel(ctx)
+	defer awaitCancel()
+
+	awaitErrCh := make(chan error, 1)
+
+	go func() {
+		awaitErrCh <- authCli.AwaitPublicKeyConfirmation(awaitCtx, publicKeyID)
+	}()
+
+	select {
+	case err = <-awaitErrCh:
+	case <-redirected:
+		awaitCancel()
+
+		// the first poll verifies the callback, if the confirmation is not visible yet, the flow keeps polling for it
+		err = awaitPublicKeyConfirmation(ctx, authCli, publicKeyID, options.DeviceCode)
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
+	printKeyRegistered(options, publicKeyID, savePath)
+
+	return pgpKey, nil
+}
+
+// loopbackHandler closes the channel on the first request to the callback path.
+func loopbackHandler(callbackPath string, redirected chan<- struct{}) http.Handler {
+	var once sync.Once
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != callbackPath {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		once.Do(func() { close(redirected) })
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		fmt.Fprintln(w, "Public key is confirmed, you can close this window.") //nolint:errcheck
+	})
+}
+
+// randomCallbackPath returns a random path of the callback URL, so that it can't be guessed by the other local processes.
+func randomCallbackPath() (string, error) {
+	state := make([]byte, 16)
+
+	if _, err := rand.Read(state); err != nil {
+		return "", err
+	}
+
+	return "/" + hex.EncodeToString(state), nil
+}
+
+func openLoginURL(loginURL string) {
 	printLoginDialog := func() {
 		fmt.Fprintf(os.Stderr, "Please visit this page to authenticate: %s\n", loginURL)
 	}
@@ -56,22 +218,167 @@ func renewUserKeyViaAuthFlow(ctx context.Context, cc *grpc.ClientConn, options *
 	} else {
 		fmt.Fprintf(os.Stderr, "Attempting to open URL: %s\n", loginURL)
 
-		err = browser.OpenURL(loginURL)
-		if err != nil {
+		if err := browser.OpenURL(loginURL); err != nil {
 			printLoginDialog()
 		}
 	}
+}
+
+// RenewUserKeyViaDeviceCode is a UserKeyFunc which renews the user key using a device code style flow.
+//
+// Unlike the default flow, it never opens a browser: the login URL and a short user code are printed to Options.InfoWriter,
+// so the key can be confirmed from any other device, e.g. for SSH sessions.
+// The confirmation is polled according to Options.DeviceCode.
+func RenewUserKeyViaDeviceCode(ctx context.Context, cc *grpc.ClientConn, options *Options) (message.Signer, error) {
+	return renewUserKeyLocked(ctx, cc, options, deviceCodeFlow)
+}
+
+func deviceCodeFlow(ctx context.Context, cc *grpc.ClientConn, options *Options) (*client.Key, error) {
+	ctx = context.WithValue(ctx, SkipInterceptorContextKey{}, struct{}{})
+
+	authCli := auth.NewClient(cc)
+
+	pgpKey, loginURL, savePath, err := registerNewUserKey(ctx, authCli, options)
+	if err != nil {
+		return nil, err
+	}
 
 	publicKeyID := pgpKey.Fingerprint()
 
-	err = authCli.AwaitPublicKeyConfirmation(ctx, publicKeyID)
+	//nolint:errcheck
+	fmt.Fprintf(options.InfoWriter, "To authenticate, visit %s on any device and confirm the key with the code %s\n", loginURL, UserCode(publicKeyID))
+
+	if err = awaitPublicKeyConfirmation(ctx, authCli, publicKeyID, options.DeviceCode); err != nil {
+		return nil, err
+	}
+
+	printKeyRegistered(options, publicKeyID, savePath)
+
+	return pgpKey, nil
+}
+
+// staleFingerprintContextKey is the context key of the fingerprint of the user key being renewed, e.g. rejected by the server.
+type staleFingerprintContextKey struct{}
+
+// renewUserKeyLocked runs the renewal flow under the cross-process key lock, see client.KeyProvider.RenewKey.
+//
+// If another process renews the key concurrently, its key is used instead of running the flow again.
+func renewUserKeyLocked(ctx context.Context, cc *grpc.ClientConn, options *Options,
+	flow func(context.Context, *grpc.ClientConn, *Options) (*client.Key, error),
+) (message.Signer, error) {
+	var renewed bool
+
+	staleFingerprint, _ := ctx.Value(staleFingerprintContextKey{}).(string)
+
+	key, err := options.UserKeyProvider.RenewKey(ctx, options.ContextName, options.Identity, staleFingerprint, func() (*client.Key, error) {
+		renewed = true
+
+		return flow(ctx, cc, options)
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if !renewed {
+		fmt.Fprintf(options.InfoWriter, "Using the key %s renewed by another process\n", key.Fingerprint()) //nolint:errcheck
+	}
+
+	return key, nil
+}
+
+// UserCode returns the short user code of the public key with the given ID, e.g. "ABCD-EF12".
+//
+// The code is the tail of the key fingerprint, so it can be matched with the key shown on the confirmation page.
+func UserCode(publicKeyID string) string {
+	code := strings.ToUpper(publicKeyID)
+	if len(code) > 8 {
+		code = code[len(code)-8:]
+	}
+
+	if len(code) <= 4 {
+		return code
+	}
+
+	return code[:len(code)-4] + "-" + code[len(code)-4:]
+}
+
+// awaitPublicKeyConfirmation polls the confirmation of the public key until it is confirmed or the timeout is reached.
+//
+// Each poll waits for the confirmation for up to the poll interval, the interval is doubled on the transient errors.
+func awaitPublicKeyConfirmation(ctx context.Context, authCli *auth.Client, publicKeyID string, options DeviceCodeOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, options.timeout())
+	defer cancel()
+
+	interval := options.pollInterval()
+
+	for {
+		pollCtx, pollCancel := context.WithTimeout(ctx, interval)
+		err := authCli.AwaitPublicKeyConfirmation(pollCtx, publicKeyID)
+
+		pollCancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out waiting for the public key confirmation: %w", err)
+		}
+
+		switch status.Code(err) { //nolint:exhaustive
+		case codes.DeadlineExceeded:
+			// the key is not confirmed yet, poll again
+			continue
+		case codes.Unavailable, codes.ResourceExhausted:
+			// transient error, back off
+		default:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the public key confirmation: %w", err)
+		case <-time.After(interval):
+		}
+
+		interval = min(interval*2, options.maxPollInterval())
+	}
+}
+
+// registerNewUserKey replaces the user key with a new one, registers it and saves it.
+//
+// It returns the new key, the login URL to confirm it and the path where the key was saved.
+func registerNewUserKey(ctx context.Context, authCli *auth.Client, options *Options, opts ...auth.RegisterPGPPublicKeyOption) (*client.Key, string, string, error) {
+	err := options.UserKeyProvider.DeleteKey(options.ContextName, options.Identity)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", "", err
+	}
+
+	pgpKey, err := options.UserKeyProvider.GenerateKey(options.ContextName, options.Identity, options.ClientName)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	publicKey, err := pgpKey.ArmorPublic()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	loginURL, err := authCli.RegisterPGPPublicKey(ctx, options.Identity, []byte(publicKey), opts...)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	savePath, err := options.UserKeyProvider.WriteKey(pgpKey)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	return pgpKey, loginURL, savePath, nil
+}
+
+func printKeyRegistered(options *Options, publicKeyID, savePath string) {
 	//nolint:errcheck
 	fmt.Fprintf(options.InfoWriter, "Public key %s is now registered for user %s\n", publicKeyID, options.Identity)
 	fmt.Fprintf(options.InfoWriter, "PGP key saved to %s\n", savePath) //nolint:errcheck
-
-	return pgpKey, nil
 }
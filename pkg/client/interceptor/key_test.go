@@ -0,0 +1,314 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package interceptor_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	authpb "github.com/siderolabs/go-api-signature/api/auth"
+	"github.com/siderolabs/go-api-signature/pkg/client/interceptor"
+	"github.com/siderolabs/go-api-signature/pkg/internal/grpctest"
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+// fakeAuthServer registers the public keys, and confirms them after the configured number of the confirmation polls.
+type fakeAuthServer struct {
+	authpb.UnimplementedAuthServiceServer
+
+	publicKeyID string
+	awaitCalls  int
+
+	// unavailablePolls is the number of the first polls which fail with codes.Unavailable.
+	unavailablePolls int
+	// confirmAfterPolls is the number of the polls after which the key is confirmed, earlier polls block until the deadline.
+	confirmAfterPolls int
+
+	lock sync.Mutex
+
+	// denyPolls makes all polls fail with codes.PermissionDenied.
+	denyPolls bool
+}
+
+func (s *fakeAuthServer) RegisterPublicKey(_ context.Context, req *authpb.RegisterPublicKeyRequest) (*authpb.RegisterPublicKeyResponse, error) {
+	key, err := pgpcrypto.NewKeyFromArmored(string(req.GetPublicKey().GetPgpData()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.publicKeyID = key.GetFingerprint()
+
+	return &authpb.RegisterPublicKeyResponse{
+		LoginUrl:    "https://example.org/authenticate?public-key-id=" + s.publicKeyID,
+		PublicKeyId: s.publicKeyID,
+	}, nil
+}
+
+func (s *fakeAuthServer) AwaitPublicKeyConfirmation(ctx context.Context, req *authpb.AwaitPublicKeyConfirmationRequest) (*emptypb.Empty, error) {
+	s.lock.Lock()
+	s.awaitCalls++
+	call := s.awaitCalls
+	publicKeyID := s.publicKeyID
+	s.lock.Unlock()
+
+	if req.GetPublicKeyId() != publicKeyID {
+		return nil, status.Error(codes.NotFound, "public key not found")
+	}
+
+	if s.denyPolls {
+		return nil, status.Error(codes.PermissionDenied, "public key was rejected")
+	}
+
+	if call <= s.unavailablePolls {
+		return nil, status.Error(codes.Unavailable, "try again later")
+	}
+
+	if call <= s.confirmAfterPolls {
+		<-ctx.Done()
+
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+type RenewFlowTestSuite struct {
+	grpctest.Suite
+}
+
+func (suite *RenewFlowTestSuite) renew(server *fakeAuthServer, deviceCode interceptor.DeviceCodeOptions) (*strings.Builder, error) {
+	suite.InitServer()
+
+	authpb.RegisterAuthServiceServer(suite.Server, server)
+
+	suite.StartServer()
+	suite.T().Cleanup(suite.StopServer)
+
+	clientConn, err := grpc.NewClient(suite.Target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	suite.Require().NoError(err)
+
+	suite.T().Cleanup(func() { clientConn.Close() }) //nolint:errcheck
+
+	dir := suite.T().TempDir()
+
+	var output strings.Builder
+
+	options := &interceptor.Options{
+		InfoWriter:      &output,
+		UserKeyProvider: client.NewKeyProviderWithFallback("keys", dir, "keys", true),
+		ContextName:     "default",
+		Identity:        "test@example.org",
+		ClientName:      "test",
+		DeviceCode:      deviceCode,
+	}
+
+	signer, err := interceptor.RenewUserKeyViaDeviceCode(suite.T().Context(), clientConn, options)
+	if err != nil {
+		return &output, err
+	}
+
+	suite.Assert().Equal(server.publicKeyID, signer.Fingerprint())
+
+	savedKey, err := options.UserKeyProvider.ReadValidKey(options.ContextName, options.Identity)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(signer.Fingerprint(), savedKey.Fingerprint())
+
+	return &output, nil
+}
+
+func (suite *RenewFlowTestSuite) TestConfirmed() {
+	server := &fakeAuthServer{
+		unavailablePolls:  1,
+		confirmAfterPolls: 3,
+	}
+
+	output, err := suite.renew(server, interceptor.DeviceCodeOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      10 * time.Second,
+	})
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(4, server.awaitCalls)
+	suite.Assert().Contains(output.String(), "https://example.org/authenticate?public-key-id="+server.publicKeyID)
+	suite.Assert().Contains(output.String(), interceptor.UserCode(server.publicKeyID))
+}
+
+func (suite *RenewFlowTestSuite) TestTimeout() {
+	server := &fakeAuthServer{
+		confirmAfterPolls: 1000,
+	}
+
+	_, err := suite.renew(server, interceptor.DeviceCodeOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      300 * time.Millisecond,
+	})
+	suite.Require().ErrorContains(err, "timed out waiting for the public key confirmation")
+}
+
+func (suite *RenewFlowTestSuite) TestPermanentError() {
+	server := &fakeAuthServer{
+		denyPolls: true,
+	}
+
+	_, err := suite.renew(server, interceptor.DeviceCodeOptions{
+		PollInterval: 50 * time.Millisecond,
+		Timeout:      10 * time.Second,
+	})
+	suite.Assert().Equal(codes.PermissionDenied, status.Code(err))
+	suite.Assert().Equal(1, server.awaitCalls)
+}
+
+func TestRenewFlowTestSuite(t *testing.T) {
+	suite.Run(t, new(RenewFlowTestSuite))
+}
+
+func TestUserCode(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "89AB-CDEF", interceptor.UserCode("0123456789abcdef"))
+	assert.Equal(t, "ABC", interceptor.UserCode("abc"))
+}
+
+// loopbackAuthServer simulates the browser redirect to the callback URL once the client starts waiting for the confirmation.
+//
+// The first confirmation poll never completes, so the flow can only complete via the loopback redirect.
+type loopbackAuthServer struct {
+	authpb.UnimplementedAuthServiceServer
+
+	callbackErr error
+	callbackURL string
+	awaitCalls  int
+	// pendingPolls is the number of the polls after the redirect which block until the deadline, e.g. if the confirmation is delayed.
+	pendingPolls int
+	lock         sync.Mutex
+}
+
+func (s *loopbackAuthServer) RegisterPublicKey(_ context.Context, req *authpb.RegisterPublicKeyRequest) (*authpb.RegisterPublicKeyResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.callbackURL = req.GetCallbackUrl()
+
+	return &authpb.RegisterPublicKeyResponse{
+		LoginUrl: "https://example.org/authenticate",
+	}, nil
+}
+
+func (s *loopbackAuthServer) AwaitPublicKeyConfirmation(ctx context.Context, _ *authpb.AwaitPublicKeyConfirmationRequest) (*emptypb.Empty, error) {
+	s.lock.Lock()
+	s.awaitCalls++
+	call := s.awaitCalls
+	callbackURL := s.callbackURL
+	s.lock.Unlock()
+
+	if call > 1+s.pendingPolls {
+		return &emptypb.Empty{}, nil
+	}
+
+	if call == 1 {
+		go s.redirect(callbackURL)
+	}
+
+	<-ctx.Done()
+
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func (s *loopbackAuthServer) redirect(callbackURL string) {
+	resp, err := http.Get(callbackURL) //nolint:noctx
+	if err == nil {
+		resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	}
+
+	s.lock.Lock()
+	s.callbackErr = err
+	s.lock.Unlock()
+}
+
+func (suite *RenewFlowTestSuite) TestLoopback() {
+	for _, test := range []struct {
+		name         string
+		pendingPolls int
+	}{
+		{
+			name: "confirmed",
+		},
+		{
+			name:         "delayed confirmation",
+			pendingPolls: 2,
+		},
+	} {
+		suite.Run(test.name, func() {
+			suite.testLoopback(test.pendingPolls)
+		})
+	}
+}
+
+func (suite *RenewFlowTestSuite) testLoopback(pendingPolls int) {
+	suite.T().Setenv("BROWSER", "echo")
+
+	server := &loopbackAuthServer{
+		pendingPolls: pendingPolls,
+	}
+
+	suite.InitServer()
+
+	authpb.RegisterAuthServiceServer(suite.Server, server)
+
+	suite.StartServer()
+	suite.T().Cleanup(suite.StopServer)
+
+	clientConn, err := grpc.NewClient(suite.Target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	suite.Require().NoError(err)
+
+	suite.T().Cleanup(func() { clientConn.Close() }) //nolint:errcheck
+
+	var output strings.Builder
+
+	ctx, cancel := context.WithTimeout(suite.T().Context(), 10*time.Second)
+	defer cancel()
+
+	_, err = interceptor.RenewUserKeyViaLoopback(ctx, clientConn, &interceptor.Options{
+		InfoWriter:      &output,
+		UserKeyProvider: client.NewKeyProviderWithFallback("keys", suite.T().TempDir(), "keys", true),
+		ContextName:     "default",
+		Identity:        "test@example.org",
+		ClientName:      "test",
+		DeviceCode: interceptor.DeviceCodeOptions{
+			PollInterval: 100 * time.Millisecond,
+		},
+	})
+	suite.Require().NoError(err)
+
+	suite.Require().EventuallyWithT(func(collect *assert.CollectT) {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+
+		assert.NoError(collect, server.callbackErr)
+		assert.Equal(collect, 2+pendingPolls, server.awaitCalls)
+	}, time.Second, 10*time.Millisecond)
+}
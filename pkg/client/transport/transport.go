@@ -0,0 +1,222 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package transport provides an HTTP client transport that signs requests.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+// RenewSignerFunc is called to obtain a new signer when the server rejects the request with 401 Unauthorized.
+type RenewSignerFunc func(ctx context.Context) (message.Signer, error)
+
+// Options are the options for the transport.
+type Options struct {
+	// Base is the underlying transport, http.DefaultTransport is used if not set.
+	Base http.RoundTripper
+
+	// Signer is the initial signer.
+	//
+	// If not set, RenewSignerFunc is called to obtain the signer on the first request.
+	Signer message.Signer
+
+	// RenewSignerFunc is called to renew the signer, e.g. interceptor.Interceptor.RenewUserKey.
+	//
+	// If not set, requests are never retried.
+	RenewSignerFunc RenewSignerFunc
+
+	Identity string
+
+	// MessageOptions are passed to message.NewHTTP on signing, e.g. message.WithHTTPMessageSignatures.
+	MessageOptions []message.Option
+}
+
+// Transport is an http.RoundTripper which signs requests.
+type Transport struct {
+	signer message.Signer
+	// renewal is the in-flight signer renewal, it is shared by the concurrent requests.
+	renewal    *signerRenewal
+	options    Options
+	signerLock sync.Mutex
+}
+
+// signerRenewal is a signer renewal shared by the concurrent requests.
+type signerRenewal struct {
+	signer message.Signer
+	err    error
+	done   chan struct{}
+}
+
+// New creates a new signing transport.
+func New(options Options) *Transport {
+	if options.Base == nil {
+		options.Base = http.DefaultTransport
+	}
+
+	return &Transport{
+		signer:  options.Signer,
+		options: options,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+//
+// The request body is buffered, so that the request can be signed and retried after the signer is renewed.
+// If the request has GetBody set (e.g. created by http.NewRequest), the body is not buffered, and GetBody is used instead,
+// which allows sending large bodies with message.WithStreamingBody.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	switch {
+	case req.Body == nil || req.Body == http.NoBody:
+	case req.GetBody != nil:
+		req.Body.Close() //nolint:errcheck
+	default:
+		var err error
+
+		body, err = io.ReadAll(req.Body)
+
+		if closeErr := req.Body.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	signer, err := t.getSigner(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.signAndSend(req, body, signer)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || t.options.RenewSignerFunc == nil {
+		return resp, err
+	}
+
+	// drain the body to allow connection reuse
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	resp.Body.Close()              //nolint:errcheck
+
+	if signer, err = t.renewSigner(req.Context(), signer); err != nil {
+		return nil, err
+	}
+
+	return t.signAndSend(req, body, signer)
+}
+
+func (t *Transport) signAndSend(req *http.Request, body []byte, signer message.Signer) (*http.Response, error) {
+	// RoundTrip must not modify the original request
+	signedReq := req.Clone(req.Context())
+
+	switch {
+	case body != nil:
+		signedReq.Body = io.NopCloser(bytes.NewReader(body))
+		signedReq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	case req.GetBody != nil && req.Body != nil && req.Body != http.NoBody:
+		var err error
+
+		if signedReq.Body, err = req.GetBody(); err != nil {
+			return nil, fmt.Errorf("failed to get request body: %w", err)
+		}
+	}
+
+	msg, err := message.NewHTTP(signedReq, t.options.MessageOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = msg.Sign(t.options.Identity, signer); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	return t.options.Base.RoundTrip(signedReq)
+}
+
+func (t *Transport) getSigner(ctx context.Context) (message.Signer, error) {
+	t.signerLock.Lock()
+	signer := t.signer
+	t.signerLock.Unlock()
+
+	if signer != nil {
+		return signer, nil
+	}
+
+	if t.options.RenewSignerFunc == nil {
+		return nil, errors.New("no signer configured")
+	}
+
+	return t.renewSigner(ctx, nil)
+}
+
+// renewSigner renews the signer rejected by the server, coalescing the concurrent renewals into a single RenewSignerFunc call.
+//
+// If the current signer is not the stale one, it was already renewed by another request, so it is returned instead.
+// If a renewal is in progress, the caller waits for it and gets its result.
+func (t *Transport) renewSigner(ctx context.Context, stale message.Signer) (message.Signer, error) {
+	t.signerLock.Lock()
+
+	if t.signer != nil && (stale == nil || t.signer.Fingerprint() != stale.Fingerprint()) {
+		signer := t.signer
+
+		t.signerLock.Unlock()
+
+		return signer, nil
+	}
+
+	if renewal := t.renewal; renewal != nil {
+		t.signerLock.Unlock()
+
+		select {
+		case <-renewal.done:
+			return renewal.signer, renewal.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	renewal := &signerRenewal{
+		done: make(chan struct{}),
+	}
+
+	t.renewal = renewal
+
+	t.signerLock.Unlock()
+
+	signer, err := t.options.RenewSignerFunc(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to renew signer: %w", err)
+	}
+
+	t.signerLock.Lock()
+
+	if err == nil {
+		t.signer = signer
+	}
+
+	renewal.signer, renewal.err = signer, err
+	t.renewal = nil
+
+	t.signerLock.Unlock()
+
+	close(renewal.done)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signer, nil
+}
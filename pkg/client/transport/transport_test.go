@@ -0,0 +1,173 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package transport_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/client/transport"
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+	"github.com/siderolabs/go-api-signature/pkg/server/auth"
+	"github.com/siderolabs/go-api-signature/pkg/server/middleware"
+)
+
+const (
+	identity = "test@example.com"
+	body     = "hello world"
+)
+
+func TestTransport(t *testing.T) {
+	expiredKey, err := pgp.GenerateKey("test", "test", identity, time.Hour)
+	require.NoError(t, err)
+
+	validKey, err := pgp.GenerateKey("test", "test", identity, time.Hour)
+	require.NoError(t, err)
+
+	resolver := message.NewMemoryKeyResolver()
+	resolver.Add(identity, validKey.Fingerprint(), validKey)
+
+	handler := middleware.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody, readErr := io.ReadAll(r.Body)
+		assert.NoError(t, readErr)
+		assert.Equal(t, body, string(requestBody))
+
+		verified, ok := auth.IdentityFromContext(r.Context())
+		assert.True(t, ok)
+
+		w.Write([]byte(verified.KeyFingerprint)) //nolint:errcheck
+	}), middleware.Options{
+		KeyResolver: resolver,
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	doRequest := func(t *testing.T, rt http.RoundTripper) *http.Response {
+		req, reqErr := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL+"/some/path?foo=bar", strings.NewReader(body))
+		require.NoError(t, reqErr)
+
+		resp, reqErr := (&http.Client{Transport: rt}).Do(req)
+		require.NoError(t, reqErr)
+
+		t.Cleanup(func() { resp.Body.Close() }) //nolint:errcheck
+
+		return resp
+	}
+
+	t.Run("valid signer", func(t *testing.T) {
+		resp := doRequest(t, transport.New(transport.Options{
+			Signer:   validKey,
+			Identity: identity,
+		}))
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("renewed signer", func(t *testing.T) {
+		var renewals atomic.Int32
+
+		rt := transport.New(transport.Options{
+			Signer:   expiredKey,
+			Identity: identity,
+			RenewSignerFunc: func(context.Context) (message.Signer, error) {
+				renewals.Add(1)
+
+				return validKey, nil
+			},
+		})
+
+		resp := doRequest(t, rt)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		respBody, readErr := io.ReadAll(resp.Body)
+		require.NoError(t, readErr)
+
+		assert.Equal(t, validKey.Fingerprint(), string(respBody))
+		assert.EqualValues(t, 1, renewals.Load())
+
+		// the renewed signer is reused
+		resp = doRequest(t, rt)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.EqualValues(t, 1, renewals.Load())
+	})
+
+	t.Run("concurrent renewal", func(t *testing.T) {
+		var renewals atomic.Int32
+
+		rt := transport.New(transport.Options{
+			Signer:   expiredKey,
+			Identity: identity,
+			RenewSignerFunc: func(context.Context) (message.Signer, error) {
+				renewals.Add(1)
+
+				// give the other requests time to fail and wait for the renewal
+				time.Sleep(100 * time.Millisecond)
+
+				return validKey, nil
+			},
+		})
+
+		const numRequests = 20
+
+		var wg sync.WaitGroup
+
+		statusCodes := make([]int, numRequests)
+		errs := make([]error, numRequests)
+
+		for i := range numRequests {
+			wg.Go(func() {
+				req, reqErr := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL, strings.NewReader(body))
+				if reqErr != nil {
+					errs[i] = reqErr
+
+					return
+				}
+
+				resp, reqErr := (&http.Client{Transport: rt}).Do(req)
+				if reqErr != nil {
+					errs[i] = reqErr
+
+					return
+				}
+
+				resp.Body.Close() //nolint:errcheck
+
+				statusCodes[i] = resp.StatusCode
+			})
+		}
+
+		wg.Wait()
+
+		for i := range numRequests {
+			require.NoError(t, errs[i])
+			assert.Equal(t, http.StatusOK, statusCodes[i])
+		}
+
+		assert.EqualValues(t, 1, renewals.Load())
+	})
+
+	t.Run("no renewal", func(t *testing.T) {
+		resp := doRequest(t, transport.New(transport.Options{
+			Signer:   expiredKey,
+			Identity: identity,
+		}))
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+}
@@ -14,3 +14,26 @@ func FileExists(filename string) bool {
 
 	return true
 }
+
+// probeWritable checks if the specified path is a writable directory by creating and removing a temporary file in it.
+func probeWritable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	f, err := os.CreateTemp(path, ".write-probe-*")
+	if err != nil {
+		return false
+	}
+
+	name := f.Name()
+
+	if err = f.Close(); err != nil {
+		os.Remove(name) //nolint:errcheck
+
+		return false
+	}
+
+	return os.Remove(name) == nil
+}
@@ -2,11 +2,14 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at http://mozilla.org/MPL/2.0/.
 
-//go:build !windows && !unix
+//go:build !unix
 
 package fileutils
 
+// IsWritable checks if the specified path is writable.
+//
+// The permission bits don't reflect the actual access rights on this platform (e.g. Windows ACLs),
+// so the directory is probed by creating a temporary file in it.
 func IsWritable(path string) bool {
-	// Not implemented for this platform.
-	return false
+	return probeWritable(path)
 }
@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package fileutils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsWritable(t *testing.T) {
+	for _, test := range []struct {
+		isWritable func(string) bool
+		name       string
+		// probe is set if the directory is probed by creating a file in it, so the regular files are not writable.
+		probe bool
+	}{
+		{
+			name:       "IsWritable",
+			isWritable: IsWritable,
+		},
+		{
+			name:       "probe",
+			isWritable: probeWritable,
+			probe:      true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			assert.True(t, test.isWritable(dir))
+
+			// the probe leaves no files behind
+			files, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, files)
+
+			assert.False(t, test.isWritable(filepath.Join(dir, "missing")))
+
+			file := filepath.Join(dir, "file")
+			require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+			if test.probe {
+				assert.False(t, test.isWritable(file))
+			}
+
+			if os.Geteuid() == 0 {
+				t.Skip("permissions are not enforced for root")
+			}
+
+			readOnly := filepath.Join(dir, "read-only")
+			require.NoError(t, os.Mkdir(readOnly, 0o500))
+
+			t.Cleanup(func() { os.Chmod(readOnly, 0o700) }) //nolint:errcheck
+
+			assert.False(t, test.isWritable(readOnly))
+		})
+	}
+}
@@ -2,7 +2,8 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at http://mozilla.org/MPL/2.0/.
 
-package interceptor_test
+// Package grpctest provides the helpers for the gRPC tests.
+package grpctest
 
 import (
 	"fmt"
@@ -12,8 +13,8 @@ import (
 	"google.golang.org/grpc"
 )
 
-// GRPCSuite is a test suite that provides a gRPC server and client.
-type GRPCSuite struct {
+// Suite is a test suite that provides a gRPC server and client.
+type Suite struct {
 	suite.Suite
 
 	listener net.Listener
@@ -25,7 +26,7 @@ type GRPCSuite struct {
 // InitServer initializes the test gRPC server.
 //
 // Options must b provided at this step, and servers must be registered before calling StartServer.
-func (suite *GRPCSuite) InitServer(opts ...grpc.ServerOption) {
+func (suite *Suite) InitServer(opts ...grpc.ServerOption) {
 	var err error
 
 	suite.listener, err = (&net.ListenConfig{}).Listen(suite.T().Context(), "tcp", "localhost:0")
@@ -42,12 +43,12 @@ func (suite *GRPCSuite) InitServer(opts ...grpc.ServerOption) {
 // StartServer starts the test gRPC server.
 //
 // This method must be called after registering all the servers.
-func (suite *GRPCSuite) StartServer() {
+func (suite *Suite) StartServer() {
 	go suite.Server.Serve(suite.listener) //nolint:errcheck
 }
 
 // StopServer stops the test gRPC server.
-func (suite *GRPCSuite) StopServer() {
+func (suite *Suite) StopServer() {
 	suite.Server.Stop()
 	suite.listener.Close() //nolint:errcheck
 }
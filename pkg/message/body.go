@@ -0,0 +1,174 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// newStreamingHTTP returns a new HTTP message which doesn't buffer the request body.
+//
+// Client requests are hashed on signing using http.Request.GetBody.
+// Server requests are verified against the Content-Digest header, and the body is verified while it is read by the handlers.
+// Server requests without the Content-Digest header (e.g. signed by the older clients) are buffered.
+func newStreamingHTTP(r *http.Request, opts Options) (*HTTP, error) {
+	if r.RequestURI == "" {
+		// client request
+		return &HTTP{
+			request:   r,
+			options:   opts,
+			streaming: true,
+		}, nil
+	}
+
+	digestHeader := r.Header.Get(ContentDigestHeaderKey)
+	if digestHeader == "" {
+		return newBufferedHTTP(r, opts)
+	}
+
+	digest, err := parseContentDigest(digestHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+
+	r.Body = &digestVerifyingReader{
+		body:     body,
+		hash:     sha256.New(),
+		expected: digest,
+		limit:    opts.MaxBodySize,
+	}
+
+	return &HTTP{
+		request:    r,
+		options:    opts,
+		bodyDigest: digest,
+		streaming:  true,
+	}, nil
+}
+
+// readBody reads the body up to the limit, zero limit means no limit.
+func readBody(body io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(body)
+	}
+
+	bodyBytes, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(bodyBytes)) > limit {
+		return nil, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, limit)
+	}
+
+	return bodyBytes, nil
+}
+
+// digestBody hashes the client request body without buffering it.
+func (m *HTTP) digestBody() error {
+	hash := sha256.New()
+
+	if m.request.Body != nil && m.request.Body != http.NoBody {
+		if m.request.GetBody == nil {
+			return errors.New("streaming body signing requires the request with GetBody set")
+		}
+
+		body, err := m.request.GetBody()
+		if err != nil {
+			return fmt.Errorf("failed to get request body: %w", err)
+		}
+
+		defer body.Close() //nolint:errcheck
+
+		reader := io.Reader(body)
+
+		if m.options.MaxBodySize > 0 {
+			reader = &limitedReader{reader: body, limit: m.options.MaxBodySize}
+		}
+
+		if _, err = io.Copy(hash, reader); err != nil {
+			return fmt.Errorf("failed to hash request body: %w", err)
+		}
+	}
+
+	m.bodyDigest = hash.Sum(nil)
+
+	return nil
+}
+
+// bodySHA256 returns the SHA-256 digest of the request body.
+func (m *HTTP) bodySHA256() []byte {
+	if m.streaming {
+		return m.bodyDigest
+	}
+
+	digest := sha256.Sum256(m.body)
+
+	return digest[:]
+}
+
+// limitedReader is like io.LimitedReader, but it returns ErrBodyTooLarge instead of truncating the body.
+type limitedReader struct {
+	reader io.Reader
+	limit  int64
+	read   int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+
+	r.read += int64(n)
+
+	if r.read > r.limit {
+		return n, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, r.limit)
+	}
+
+	return n, err
+}
+
+// digestVerifyingReader hashes the request body while it is read, and fails at the end of the body if it doesn't match the digest.
+type digestVerifyingReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected []byte
+	limit    int64
+	read     int64
+}
+
+func (r *digestVerifyingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+
+	r.hash.Write(p[:n]) //nolint:errcheck
+	r.read += int64(n)
+
+	if r.limit > 0 && r.read > r.limit {
+		return n, fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, r.limit)
+	}
+
+	if errors.Is(err, io.EOF) && !bytes.Equal(r.hash.Sum(nil), r.expected) {
+		return n, &VerificationError{
+			Reason: ReasonBodyMismatch,
+			Header: ContentDigestHeaderKey,
+			Err:    ErrBodyDigestMismatch,
+		}
+	}
+
+	return n, err
+}
+
+func (r *digestVerifyingReader) Close() error {
+	return r.body.Close()
+}
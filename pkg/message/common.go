@@ -5,12 +5,13 @@
 package message
 
 import (
-	"encoding/base64"
 	"errors"
-	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
 )
 
 const (
@@ -23,13 +24,20 @@ const (
 	// PayloadHeaderKey is the header name for the signed payload.
 	PayloadHeaderKey = "x-sidero-payload"
 
+	// NonceHeaderKey is the header name for the random nonce used for the replay protection.
+	NonceHeaderKey = "x-sidero-nonce"
+
 	// AuthorizationHeaderKey is Authorization: header name.
 	AuthorizationHeaderKey = "authorization"
 
 	// BearerPrefix is the prefix for the Authorization: header value.
 	BearerPrefix = "Bearer "
 
-	timestampAllowedSkew = 5 * time.Minute
+	// DefaultAllowedClockSkew is the default allowed skew of the message timestamp.
+	DefaultAllowedClockSkew = 5 * time.Minute
+
+	// DefaultMaxBodySize is the default limit of the HTTP request body buffered in memory (DoS protection).
+	DefaultMaxBodySize = 1024 * 1024
 )
 
 // Well-known metadata keys which should be verified.
@@ -50,14 +58,23 @@ var ErrNotFound = errors.New("not found")
 // ErrInvalidSignature is returned when a signature is invalid.
 var ErrInvalidSignature = errors.New("invalid signature")
 
+// ErrReplayedSignature is returned when a signature was already seen by the replay store.
+var ErrReplayedSignature = errors.New("replayed signature")
+
+// ErrBodyTooLarge is returned when the HTTP request body exceeds the configured limit.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrBodyDigestMismatch is returned when the streamed HTTP request body does not match its signed digest.
+var ErrBodyDigestMismatch = errors.New("request body does not match the digest")
+
 func parseTimestamp(value string) (*time.Time, error) {
 	if value == "" {
-		return nil, fmt.Errorf("%w: %s", ErrNotFound, TimestampHeaderKey)
+		return nil, verificationErrorf(ReasonMalformedHeader, TimestampHeaderKey, "%w: %s", ErrNotFound, TimestampHeaderKey)
 	}
 
 	timestampInt, err := strconv.ParseInt(value, 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, verificationErrorf(ReasonMalformedHeader, TimestampHeaderKey, "invalid timestamp: %w", err)
 	}
 
 	timestamp := time.Unix(timestampInt, 0)
@@ -66,61 +83,50 @@ func parseTimestamp(value string) (*time.Time, error) {
 }
 
 func parseSignature(value string, requiredCheck SignatureRequiredCheckFunc) (*Signature, error) {
-	if requiredCheck == nil {
-		requiredCheck = func() (bool, error) {
-			return true, nil
-		}
-	}
-
-	signature, err := parseSignatureValue(value)
+	signature, err := ParseSignatureHeader(value)
 	if err != nil {
-		if errors.Is(err, ErrNotFound) {
-			required, requiredErr := requiredCheck()
-			if requiredErr != nil {
-				return nil, requiredErr
-			}
-
-			if required {
-				return nil, ErrInvalidSignature
-			}
-		}
-
-		return nil, err
+		return nil, checkMissingSignature(err, requiredCheck)
 	}
 
 	return signature, nil
 }
 
-func parseSignatureValue(value string) (*Signature, error) {
-	if value == "" {
-		return nil, fmt.Errorf("%w: %s", ErrNotFound, SignatureHeaderKey)
+// checkMissingSignature returns ErrInvalidSignature (with ReasonMissingSignature) instead of ErrNotFound if the signature is required.
+func checkMissingSignature(err error, requiredCheck SignatureRequiredCheckFunc) error {
+	if !errors.Is(err, ErrNotFound) {
+		return err
 	}
 
-	signatureParts := strings.Split(value, " ")
-	if len(signatureParts) == 0 {
-		return nil, fmt.Errorf("invalid signature header: %s", value)
+	if requiredCheck == nil {
+		return missingSignatureError()
 	}
 
-	if signatureParts[0] != string(SignatureVersionV1) {
-		return nil, fmt.Errorf("unsupported signature version: %s", signatureParts[0])
+	required, requiredErr := requiredCheck()
+	if requiredErr != nil {
+		return requiredErr
 	}
 
-	signature, err := base64.StdEncoding.DecodeString(signatureParts[3])
-	if err != nil {
-		return nil, err
+	if required {
+		return missingSignatureError()
 	}
 
-	return &Signature{
-		Signature:      signature,
-		Identity:       signatureParts[1],
-		KeyFingerprint: signatureParts[2],
-	}, nil
+	return err
+}
+
+func missingSignatureError() error {
+	return &VerificationError{
+		Reason: ReasonMissingSignature,
+		Err:    ErrInvalidSignature,
+	}
 }
 
-func verifyTimestamp(timestamp *time.Time) error {
-	if time.Now().Add(timestampAllowedSkew).Before(*timestamp) ||
-		time.Now().Add(-timestampAllowedSkew).After(*timestamp) {
-		return fmt.Errorf("timestamp is outside of allowed skew: %s", timestamp)
+func verifyTimestamp(timestamp *time.Time, opts *Options) error {
+	now := opts.now()
+	allowedSkew := opts.allowedClockSkew()
+
+	if now.Add(allowedSkew).Before(*timestamp) ||
+		now.Add(-allowedSkew).After(*timestamp) {
+		return verificationErrorf(ReasonExpiredTimestamp, TimestampHeaderKey, "timestamp is outside of allowed skew: %s", timestamp)
 	}
 
 	return nil
@@ -131,7 +137,67 @@ type SignatureRequiredCheckFunc func() (bool, error)
 
 // Options contains configuration options for message processing.
 type Options struct {
-	SignatureRequiredCheck SignatureRequiredCheckFunc
+	SignatureRequiredCheck   SignatureRequiredCheckFunc
+	ReplayStore              ReplayStore
+	Clock                    func() time.Time
+	SignatureVersion         SignatureVersion
+	RequiredSignatureVersion SignatureVersion
+	HTTPAuthority            string
+	SignedHeaders            []string
+	AdditionalSignedHeaders  []string
+	KeyValidationOptions     []pgp.ValidationOption
+	AllowedClockSkew         time.Duration
+	MaxBodySize              int64
+	Nonce                    bool
+	HTTPMessageSignatures    bool
+	StreamingBody            bool
+}
+
+func (o *Options) now() time.Time {
+	if o.Clock != nil {
+		return o.Clock()
+	}
+
+	return time.Now()
+}
+
+func (o *Options) allowedClockSkew() time.Duration {
+	if o.AllowedClockSkew > 0 {
+		return o.AllowedClockSkew
+	}
+
+	return DefaultAllowedClockSkew
+}
+
+// maxBodySize returns the limit of the buffered HTTP request body, zero means no limit.
+func (o *Options) maxBodySize() int64 {
+	if o.MaxBodySize != 0 {
+		return max(o.MaxBodySize, 0)
+	}
+
+	return DefaultMaxBodySize
+}
+
+// signedHeaders returns the set of the metadata headers covered by the GRPC payload.
+func (o *Options) signedHeaders() []string {
+	headers := slices.Clone(includedHeaders)
+
+	if o.SignedHeaders != nil {
+		// timestamp and nonce are always signed, as they are required for the signature freshness
+		headers = []string{TimestampHeaderKey, NonceHeaderKey}
+
+		for _, header := range o.SignedHeaders {
+			headers = append(headers, strings.ToLower(header))
+		}
+	}
+
+	for _, header := range o.AdditionalSignedHeaders {
+		headers = append(headers, strings.ToLower(header))
+	}
+
+	slices.Sort(headers)
+
+	return slices.Compact(headers)
 }
 
 // Option is a function that configures Options.
@@ -143,3 +209,119 @@ func WithSignatureRequiredCheck(f SignatureRequiredCheckFunc) Option {
 		o.SignatureRequiredCheck = f
 	}
 }
+
+// WithReplayStore enables the replay protection in the signature verification using the given store.
+func WithReplayStore(store ReplayStore) Option {
+	return func(o *Options) {
+		o.ReplayStore = store
+	}
+}
+
+// WithNonce sets whether a random nonce should be added to HTTP messages on signing.
+//
+// GRPC messages always carry a nonce, as it is compatible with the older verifiers.
+// HTTP messages with a nonce can only be verified by the verifiers which support it.
+func WithNonce(nonce bool) Option {
+	return func(o *Options) {
+		o.Nonce = nonce
+	}
+}
+
+// WithSignatureVersion sets the signature version used on signing GRPC messages.
+//
+// SignatureVersionV1 is used by default, as SignatureVersionV2 is not supported by the older verifiers.
+// HTTP messages are always signed with SignatureVersionV1, as their payload already covers the request body.
+func WithSignatureVersion(version SignatureVersion) Option {
+	return func(o *Options) {
+		o.SignatureVersion = version
+	}
+}
+
+// WithRequiredSignatureVersion rejects the GRPC signatures of the other versions in the signature verification.
+//
+// E.g. SignatureVersionV2 requires the request body to be covered by the signature.
+func WithRequiredSignatureVersion(version SignatureVersion) Option {
+	return func(o *Options) {
+		o.RequiredSignatureVersion = version
+	}
+}
+
+// WithSignedHeaders replaces the default set of the metadata headers covered by the GRPC payload.
+//
+// Timestamp and nonce headers are always covered.
+func WithSignedHeaders(headers ...string) Option {
+	return func(o *Options) {
+		o.SignedHeaders = append(o.SignedHeaders, headers...)
+	}
+}
+
+// WithAdditionalSignedHeaders adds the metadata headers to the set of the headers covered by the GRPC payload.
+func WithAdditionalSignedHeaders(headers ...string) Option {
+	return func(o *Options) {
+		o.AdditionalSignedHeaders = append(o.AdditionalSignedHeaders, headers...)
+	}
+}
+
+// WithAllowedClockSkew sets the allowed skew of the message timestamp in the signature verification.
+func WithAllowedClockSkew(allowedClockSkew time.Duration) Option {
+	return func(o *Options) {
+		o.AllowedClockSkew = allowedClockSkew
+	}
+}
+
+// WithClock sets the clock used to timestamp the messages on signing and to verify the timestamps on verification.
+func WithClock(clock func() time.Time) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// WithKeyValidationOptions sets the options for the validation of the PGP keys returned by a KeyResolver.
+//
+// PGP keys are validated before the verification in VerifyWith, so the server interceptor and middleware validate them too.
+func WithKeyValidationOptions(opts ...pgp.ValidationOption) Option {
+	return func(o *Options) {
+		o.KeyValidationOptions = append(o.KeyValidationOptions, opts...)
+	}
+}
+
+// WithHTTPMessageSignatures sets whether HTTP messages should be signed using RFC 9421 HTTP Message Signatures.
+//
+// The signature covers the method, the authority, the path, the query and the Content-Digest of the body.
+// The verification detects the signature format automatically.
+func WithHTTPMessageSignatures(enabled bool) Option {
+	return func(o *Options) {
+		o.HTTPMessageSignatures = enabled
+	}
+}
+
+// WithHTTPAuthority overrides the authority of the HTTP request used by the RFC 9421 HTTP message signatures.
+//
+// It should be set on verification behind the proxies which rewrite the Host header, to the authority the clients send the requests to.
+func WithHTTPAuthority(authority string) Option {
+	return func(o *Options) {
+		o.HTTPAuthority = authority
+	}
+}
+
+// WithMaxBodySize sets the limit of the HTTP request body.
+//
+// DefaultMaxBodySize is used by default for the buffered bodies, the streamed bodies are not limited unless the limit is set.
+// A negative value disables the limit. ErrBodyTooLarge is returned when the limit is exceeded.
+func WithMaxBodySize(size int64) Option {
+	return func(o *Options) {
+		o.MaxBodySize = size
+	}
+}
+
+// WithStreamingBody sets whether the HTTP request body should be hashed incrementally instead of being buffered in memory.
+//
+// On signing, the body is hashed using http.Request.GetBody and the digest is sent in the Content-Digest header.
+// On verification, the signature is verified against the Content-Digest header, and the request body is replaced
+// with a reader which returns ErrBodyDigestMismatch at the end of the body if it doesn't match the digest.
+// So the handlers must read the body to the end and handle the read errors before acting on it.
+func WithStreamingBody(enabled bool) Option {
+	return func(o *Options) {
+		o.StreamingBody = enabled
+	}
+}
@@ -0,0 +1,107 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"errors"
+	"fmt"
+)
+
+// VerificationReason is the reason of a signature verification failure.
+type VerificationReason int
+
+// Verification failure reasons.
+const (
+	ReasonUnknown VerificationReason = iota
+	ReasonMissingSignature
+	ReasonMalformedHeader
+	ReasonUnsupportedVersion
+	ReasonExpiredTimestamp
+	ReasonMethodMismatch
+	ReasonHeaderMismatch
+	ReasonBodyMismatch
+	ReasonUnknownKey
+	ReasonInvalidKey
+	ReasonBadSignature
+	ReasonReplayedSignature
+)
+
+// String returns the reason in snake case, e.g. to be used as a metric label.
+func (r VerificationReason) String() string {
+	switch r {
+	case ReasonUnknown:
+		return "unknown"
+	case ReasonMissingSignature:
+		return "missing_signature"
+	case ReasonMalformedHeader:
+		return "malformed_header"
+	case ReasonUnsupportedVersion:
+		return "unsupported_version"
+	case ReasonExpiredTimestamp:
+		return "expired_timestamp"
+	case ReasonMethodMismatch:
+		return "method_mismatch"
+	case ReasonHeaderMismatch:
+		return "header_mismatch"
+	case ReasonBodyMismatch:
+		return "body_mismatch"
+	case ReasonUnknownKey:
+		return "unknown_key"
+	case ReasonInvalidKey:
+		return "invalid_key"
+	case ReasonBadSignature:
+		return "bad_signature"
+	case ReasonReplayedSignature:
+		return "replayed_signature"
+	}
+
+	return fmt.Sprintf("VerificationReason(%d)", int(r))
+}
+
+// VerificationError is returned when a message fails the signature verification.
+//
+// It wraps the underlying error, so the sentinel errors (e.g. ErrNotFound, ErrInvalidSignature, ErrReplayedSignature) can still be matched with errors.Is.
+// Errors can be matched by the reason with errors.Is(err, &VerificationError{Reason: ReasonBadSignature}).
+type VerificationError struct {
+	Err error
+
+	// Header is the header (or the RFC 9421 component) which failed the verification, if applicable.
+	Header string
+
+	Reason VerificationReason
+}
+
+// Error implements error.
+func (e *VerificationError) Error() string {
+	if e.Err == nil {
+		return e.Reason.String()
+	}
+
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the errors by the reason, and by the header if the target header is set.
+func (e *VerificationError) Is(target error) bool {
+	var targetErr *VerificationError
+
+	if !errors.As(target, &targetErr) {
+		return false
+	}
+
+	return e.Reason == targetErr.Reason && (targetErr.Header == "" || e.Header == targetErr.Header)
+}
+
+func verificationErrorf(reason VerificationReason, header, format string, args ...any) error {
+	return &VerificationError{
+		Reason: reason,
+		Header: header,
+		Err:    fmt.Errorf(format, args...),
+	}
+}
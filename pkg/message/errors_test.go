@@ -0,0 +1,170 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+func TestVerificationError(t *testing.T) {
+	t.Parallel()
+
+	const method = "some.method.Name"
+
+	for _, tt := range []struct {
+		mutator        func(*message.GRPC)
+		expectedErr    error
+		name           string
+		expectedHeader string
+		expectedReason message.VerificationReason
+	}{
+		{
+			name: "expired timestamp",
+			mutator: func(m *message.GRPC) {
+				m.Options.Clock = func() time.Time { return time.Now().Add(time.Hour) }
+			},
+			expectedReason: message.ReasonExpiredTimestamp,
+			expectedHeader: message.TimestampHeaderKey,
+		},
+		{
+			name: "malformed timestamp",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Set(message.TimestampHeaderKey, "yesterday")
+			},
+			expectedReason: message.ReasonMalformedHeader,
+			expectedHeader: message.TimestampHeaderKey,
+		},
+		{
+			name: "header mismatch",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Set(message.ClusterHeaderKey, "bar")
+			},
+			expectedReason: message.ReasonHeaderMismatch,
+			expectedHeader: message.ClusterHeaderKey,
+		},
+		{
+			name: "method mismatch",
+			mutator: func(m *message.GRPC) {
+				m.Method = "other.method.Name"
+			},
+			expectedReason: message.ReasonMethodMismatch,
+		},
+		{
+			name: "bad signature",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Set(message.SignatureHeaderKey, "siderov1 test@example.com mock-fingerprint Zm9v")
+			},
+			expectedReason: message.ReasonBadSignature,
+		},
+		{
+			name: "unsupported version",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Set(message.SignatureHeaderKey, "siderov0 test@example.com mock-fingerprint Zm9v")
+			},
+			expectedReason: message.ReasonUnsupportedVersion,
+			expectedHeader: message.SignatureHeaderKey,
+		},
+		{
+			name: "malformed signature",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Set(message.SignatureHeaderKey, "siderov1 test@example.com")
+			},
+			expectedReason: message.ReasonMalformedHeader,
+			expectedHeader: message.SignatureHeaderKey,
+		},
+		{
+			name: "missing signature",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Delete(message.SignatureHeaderKey)
+			},
+			expectedReason: message.ReasonMissingSignature,
+			expectedErr:    message.ErrInvalidSignature,
+		},
+		{
+			name: "missing payload",
+			mutator: func(m *message.GRPC) {
+				m.Metadata.Delete(message.PayloadHeaderKey)
+			},
+			expectedReason: message.ReasonMalformedHeader,
+			expectedHeader: message.PayloadHeaderKey,
+			expectedErr:    message.ErrNotFound,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := message.NewGRPC(metadata.Pairs(message.ClusterHeaderKey, "foo"), method)
+
+			require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+			tt.mutator(m)
+
+			err := m.VerifySignature(mockSignerVerifier{})
+			require.Error(t, err)
+
+			var verificationErr *message.VerificationError
+
+			require.ErrorAs(t, err, &verificationErr)
+
+			assert.Equal(t, tt.expectedReason, verificationErr.Reason)
+			assert.Equal(t, tt.expectedHeader, verificationErr.Header)
+
+			assert.ErrorIs(t, err, &message.VerificationError{Reason: tt.expectedReason})
+			assert.NotErrorIs(t, err, &message.VerificationError{Reason: message.ReasonUnknown})
+
+			if tt.expectedHeader != "" {
+				assert.ErrorIs(t, err, &message.VerificationError{Reason: tt.expectedReason, Header: tt.expectedHeader})
+				assert.NotErrorIs(t, err, &message.VerificationError{Reason: tt.expectedReason, Header: "other"})
+			}
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+
+	t.Run("replayed signature", func(t *testing.T) {
+		t.Parallel()
+
+		m := message.NewGRPC(metadata.Pairs(), method, message.WithReplayStore(message.NewMemoryReplayStore()))
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+		require.NoError(t, m.VerifySignature(mockSignerVerifier{}))
+
+		err := m.VerifySignature(mockSignerVerifier{})
+
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonReplayedSignature})
+		assert.ErrorIs(t, err, message.ErrReplayedSignature)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		t.Parallel()
+
+		m := message.NewGRPC(metadata.Pairs(), method)
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		_, err := m.VerifyWith(t.Context(), message.NewMemoryKeyResolver())
+
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonUnknownKey})
+		assert.ErrorIs(t, err, message.ErrKeyNotFound)
+	})
+
+	t.Run("reason string", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Equal(t, "expired_timestamp", message.ReasonExpiredTimestamp.String())
+		assert.Equal(t, "VerificationReason(100)", message.VerificationReason(100).String())
+		assert.Equal(t, "bad_signature", (&message.VerificationError{Reason: message.ReasonBadSignature}).Error())
+		assert.NotErrorIs(t, &message.VerificationError{Reason: message.ReasonBadSignature}, message.ErrNotFound)
+	})
+}
@@ -6,15 +6,16 @@ package message
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 
 	authpb "github.com/siderolabs/go-api-signature/api/auth"
 	"github.com/siderolabs/go-api-signature/pkg/jwt"
@@ -23,8 +24,22 @@ import (
 // GRPC represents a gRPC message.
 type GRPC struct {
 	Metadata metadata.MD
-	Options  Options
-	Method   string
+
+	// Request is the request message, it is covered by the signature in SignatureVersionV2.
+	//
+	// It should be nil for the streaming calls, as the stream is signed before any message is sent.
+	// SignatureVersionV2 doesn't cover the stream messages, they are covered by the per-message signatures,
+	// see StreamSigner and StreamVerifier.
+	Request proto.Message
+
+	// RequestData is the wire encoding of the request message.
+	//
+	// If it is set, the signature covers it instead of the re-marshaled Request: the deterministic marshaling
+	// is not canonical, e.g. the unknown fields of an older protobuf schema change it.
+	RequestData []byte
+
+	Options Options
+	Method  string
 }
 
 // NewGRPC creates a new GRPC from the given metadata and method.
@@ -45,10 +60,15 @@ func NewGRPC(md metadata.MD, method string, options ...Option) *GRPC {
 func (m *GRPC) payload() (*GRPCPayload, error) {
 	headerValue := m.firstHeader(PayloadHeaderKey)
 	if headerValue == "" {
-		return nil, fmt.Errorf("%w: %s", ErrNotFound, PayloadHeaderKey)
+		return nil, verificationErrorf(ReasonMalformedHeader, PayloadHeaderKey, "%w: %s", ErrNotFound, PayloadHeaderKey)
+	}
+
+	payload, err := ParseGRPCPayload([]byte(headerValue))
+	if err != nil {
+		return nil, verificationErrorf(ReasonMalformedHeader, PayloadHeaderKey, "invalid payload: %w", err)
 	}
 
-	return ParseGRPCPayload([]byte(headerValue))
+	return payload, nil
 }
 
 func (m *GRPC) timestamp() (*time.Time, error) {
@@ -86,15 +106,42 @@ func (m *GRPC) JWT() (string, error) {
 	return token, nil
 }
 
-// Sign signs the message with the given signer for SignatureVersionV1.
+// Sign signs the message with the given signer.
+//
+// The signature version is set by WithSignatureVersion, SignatureVersionV1 is used by default.
 func (m *GRPC) Sign(identity string, signer Signer) error {
-	m.Metadata.Set(TimestampHeaderKey, strconv.FormatInt(time.Now().Unix(), 10))
+	version := m.Options.SignatureVersion
+	if version == "" {
+		version = SignatureVersionV1
+	}
+
+	if version != SignatureVersionV1 && version != SignatureVersionV2 {
+		return fmt.Errorf("unsupported signature version: %s", version)
+	}
+
+	m.Metadata.Set(TimestampHeaderKey, strconv.FormatInt(m.Options.now().Unix(), 10))
+
+	nonce, err := generateNonce()
+	if err != nil {
+		return err
+	}
+
+	m.Metadata.Set(NonceHeaderKey, nonce)
 
 	// if the request is re-signed, remove payload/signature headers which might be already present
 	m.Metadata.Delete(PayloadHeaderKey)
 	m.Metadata.Delete(SignatureHeaderKey)
 
-	payload := BuildGRPCPayload(m.Metadata, m.Method)
+	payload := BuildGRPCPayloadWithHeaders(m.Metadata, m.Method, m.Options.signedHeaders())
+
+	if version == SignatureVersionV2 {
+		payload.Version = version
+
+		payload.BodyDigest, err = m.requestDigest()
+		if err != nil {
+			return err
+		}
+	}
 
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
@@ -106,10 +153,18 @@ func (m *GRPC) Sign(identity string, signer Signer) error {
 		return err
 	}
 
-	signatureBase64 := base64.StdEncoding.EncodeToString(signature)
+	signatureHeader, err := FormatSignatureHeader(&Signature{
+		Version:        version,
+		Identity:       identity,
+		KeyFingerprint: signer.Fingerprint(),
+		Signature:      signature,
+	})
+	if err != nil {
+		return err
+	}
 
 	m.Metadata.Set(PayloadHeaderKey, string(payloadJSON))
-	m.Metadata.Set(SignatureHeaderKey, fmt.Sprintf("%s %s %s %s", SignatureVersionV1, identity, signer.Fingerprint(), signatureBase64))
+	m.Metadata.Set(SignatureHeaderKey, signatureHeader)
 
 	return nil
 }
@@ -132,17 +187,26 @@ func (m *GRPC) VerifySignature(verifier SignatureVerifier) error {
 		return err
 	}
 
-	err = verifyTimestamp(timestamp)
+	err = verifyTimestamp(timestamp, &m.Options)
 	if err != nil {
 		return err
 	}
 
+	signature, err := m.Signature()
+	if err != nil {
+		return err
+	}
+
+	if required := m.Options.RequiredSignatureVersion; required != "" && signature.Version != required {
+		return verificationErrorf(ReasonUnsupportedVersion, SignatureHeaderKey, "signature version %s is not allowed, %s is required", signature.Version, required)
+	}
+
 	payload, err := m.payload()
 	if err != nil {
 		return err
 	}
 
-	err = m.verifyPayload(payload)
+	err = m.verifyPayload(payload, signature.Version)
 	if err != nil {
 		return err
 	}
@@ -152,32 +216,96 @@ func (m *GRPC) VerifySignature(verifier SignatureVerifier) error {
 		return err
 	}
 
+	if err = verifier.Verify(payloadJSON, signature.Signature); err != nil {
+		return verificationErrorf(ReasonBadSignature, "", "%w", err)
+	}
+
+	return checkReplay(&m.Options, signature, m.firstHeader(NonceHeaderKey), timestamp)
+}
+
+// VerifyWith resolves the signing key using the resolver and verifies the signature of the message.
+//
+// The verified signature is returned on success.
+func (m *GRPC) VerifyWith(ctx context.Context, resolver KeyResolver) (*Signature, error) {
 	signature, err := m.Signature()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	verifier, err := resolveVerifier(ctx, resolver, signature, &m.Options)
+	if err != nil {
+		return nil, err
 	}
 
-	return verifier.Verify(payloadJSON, signature.Signature)
+	if err = m.VerifySignature(verifier); err != nil {
+		return nil, err
+	}
+
+	return signature, nil
 }
 
-func (m *GRPC) verifyPayload(payload *GRPCPayload) error {
+func (m *GRPC) verifyPayload(payload *GRPCPayload, version SignatureVersion) error {
 	if payload == nil {
-		return fmt.Errorf("%w: %s", ErrNotFound, PayloadHeaderKey)
+		return verificationErrorf(ReasonMalformedHeader, PayloadHeaderKey, "%w: %s", ErrNotFound, PayloadHeaderKey)
 	}
 
 	if payload.Method != m.Method {
-		return fmt.Errorf("payload method does not match: %s != %s", payload.Method, m.Method)
+		return verificationErrorf(ReasonMethodMismatch, "", "payload method does not match: %s != %s", payload.Method, m.Method)
 	}
 
-	for _, header := range includedHeaders {
+	// verify the headers required by the verifier, and the headers the signer covered on top of them
+	for _, header := range slices.Concat(m.Options.signedHeaders(), payload.SignedHeaders()) {
 		if !reflect.DeepEqual(payload.Headers[header], m.Metadata[header]) {
-			return fmt.Errorf("payload header does not match: %s", header)
+			return verificationErrorf(ReasonHeaderMismatch, header, "payload header does not match: %s", header)
+		}
+	}
+
+	// the signature version header is not signed, so the version is verified against the signed payload
+	// to prevent downgrading the v2 signatures to v1, which doesn't cover the request body
+	if (payload.Version != "" || version == SignatureVersionV2) && payload.Version != version {
+		return verificationErrorf(ReasonHeaderMismatch, SignatureHeaderKey, "payload signature version does not match: %s != %s", payload.Version, version)
+	}
+
+	if version == SignatureVersionV1 && payload.BodyDigest == "" {
+		// the request body is not covered by the v1 signature
+		return nil
+	}
+
+	bodyDigest, err := m.requestDigest()
+	if err != nil {
+		return err
+	}
+
+	if bodyDigest == "" {
+		if payload.BodyDigest != "" {
+			return verificationErrorf(ReasonBodyMismatch, "", "payload body digest can't be verified without the request")
 		}
+
+		return nil
+	}
+
+	if payload.BodyDigest != bodyDigest {
+		return verificationErrorf(ReasonBodyMismatch, "", "payload body digest does not match")
 	}
 
 	return nil
 }
 
+// requestDigest returns the digest of RequestData, or of Request if RequestData is not set.
+//
+// It returns an empty digest if there is no request.
+func (m *GRPC) requestDigest() (string, error) {
+	if m.RequestData != nil {
+		return RequestDataDigest(m.RequestData), nil
+	}
+
+	if m.Request == nil {
+		return "", nil
+	}
+
+	return RequestDigest(m.Request)
+}
+
 func (m *GRPC) firstHeader(name string) string {
 	values := m.Metadata.Get(name)
 	if len(values) == 0 {
@@ -12,7 +12,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/interop/grpc_testing"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 
 	authpb "github.com/siderolabs/go-api-signature/api/auth"
 	"github.com/siderolabs/go-api-signature/pkg/message"
@@ -174,3 +177,293 @@ func TestGRPCMessageSignatures(t *testing.T) {
 		require.ErrorIs(t, err, message.ErrNotFound)
 	})
 }
+
+func TestGRPCReplay(t *testing.T) {
+	t.Parallel()
+
+	store := message.NewMemoryReplayStore()
+
+	sign := func() metadata.MD {
+		m := message.NewGRPC(metadata.Pairs("cluster", "foo"), "some.method.Name")
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		return m.Metadata
+	}
+
+	verify := func(md metadata.MD) error {
+		return message.NewGRPC(md.Copy(), "some.method.Name", message.WithReplayStore(store)).VerifySignature(mockSignerVerifier{})
+	}
+
+	md := sign()
+
+	require.NoError(t, verify(md))
+	require.ErrorIs(t, verify(md), message.ErrReplayedSignature)
+
+	// each signing generates a new nonce
+	require.NoError(t, verify(sign()))
+
+	// the nonce is covered by the signature
+	md = sign()
+	md.Set(message.NonceHeaderKey, "replaced")
+
+	require.Error(t, verify(md))
+}
+
+func TestGRPCRequestBinding(t *testing.T) {
+	t.Parallel()
+
+	request := &grpc_testing.SimpleRequest{
+		Payload: &grpc_testing.Payload{
+			Body: []byte("original"),
+		},
+	}
+
+	tamperedRequest := &grpc_testing.SimpleRequest{
+		Payload: &grpc_testing.Payload{
+			Body: []byte("tampered"),
+		},
+	}
+
+	sign := func(t *testing.T, version message.SignatureVersion) metadata.MD {
+		m := message.NewGRPC(metadata.Pairs("cluster", "foo"), "some.method.Name", message.WithSignatureVersion(version))
+		m.Request = request
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		signature, err := m.Signature()
+		require.NoError(t, err)
+
+		assert.Equal(t, version, signature.Version)
+
+		return m.Metadata
+	}
+
+	verify := func(md metadata.MD, req *grpc_testing.SimpleRequest) error {
+		m := message.NewGRPC(md.Copy(), "some.method.Name")
+
+		if req != nil {
+			m.Request = req
+		}
+
+		return m.VerifySignature(mockSignerVerifier{})
+	}
+
+	t.Run("v1", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t, message.SignatureVersionV1)
+
+		assert.NoError(t, verify(md, request))
+		assert.NoError(t, verify(md, tamperedRequest))
+	})
+
+	t.Run("v2", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t, message.SignatureVersionV2)
+
+		assert.NoError(t, verify(md, request))
+		assert.Error(t, verify(md, tamperedRequest))
+		assert.Error(t, verify(md, nil))
+	})
+
+	relabel := func(t *testing.T, md metadata.MD, version message.SignatureVersion) metadata.MD {
+		m := message.NewGRPC(md.Copy(), "some.method.Name")
+
+		signature, err := m.Signature()
+		require.NoError(t, err)
+
+		signature.Version = version
+
+		header, err := message.FormatSignatureHeader(signature)
+		require.NoError(t, err)
+
+		m.Metadata.Set(message.SignatureHeaderKey, header)
+
+		return m.Metadata
+	}
+
+	t.Run("v2 request data", func(t *testing.T) {
+		t.Parallel()
+
+		requestData, err := proto.Marshal(request)
+		require.NoError(t, err)
+
+		// the server might decode the request with a different schema, dropping the fields it doesn't know
+		requestData = protowire.AppendTag(requestData, 100, protowire.BytesType)
+		requestData = protowire.AppendBytes(requestData, []byte("unknown to the server"))
+
+		m := message.NewGRPC(metadata.Pairs("cluster", "foo"), "some.method.Name", message.WithSignatureVersion(message.SignatureVersionV2))
+		m.Request = request
+		m.RequestData = requestData
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		verifyData := func(data []byte) error {
+			v := message.NewGRPC(m.Metadata.Copy(), "some.method.Name")
+			v.Request = request
+			v.RequestData = data
+
+			return v.VerifySignature(mockSignerVerifier{})
+		}
+
+		assert.NoError(t, verifyData(requestData))
+		assert.ErrorIs(t, verifyData(requestData[:len(requestData)-1]), &message.VerificationError{Reason: message.ReasonBodyMismatch})
+
+		// the re-marshaled request doesn't match the sent encoding
+		assert.Error(t, verify(m.Metadata, request))
+	})
+
+	t.Run("v2 relabeled as v1", func(t *testing.T) {
+		t.Parallel()
+
+		md := relabel(t, sign(t, message.SignatureVersionV2), message.SignatureVersionV1)
+
+		err := verify(md, tamperedRequest)
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonHeaderMismatch, Header: message.SignatureHeaderKey})
+
+		assert.Error(t, verify(md, request))
+	})
+
+	t.Run("v1 relabeled as v2", func(t *testing.T) {
+		t.Parallel()
+
+		md := relabel(t, sign(t, message.SignatureVersionV1), message.SignatureVersionV2)
+
+		err := verify(md, request)
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonHeaderMismatch, Header: message.SignatureHeaderKey})
+	})
+
+	t.Run("required version", func(t *testing.T) {
+		t.Parallel()
+
+		verifyRequired := func(md metadata.MD) error {
+			m := message.NewGRPC(md.Copy(), "some.method.Name", message.WithRequiredSignatureVersion(message.SignatureVersionV2))
+			m.Request = request
+
+			return m.VerifySignature(mockSignerVerifier{})
+		}
+
+		assert.NoError(t, verifyRequired(sign(t, message.SignatureVersionV2)))
+
+		err := verifyRequired(sign(t, message.SignatureVersionV1))
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonUnsupportedVersion})
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		t.Parallel()
+
+		m := message.NewGRPC(metadata.Pairs(), "some.method.Name", message.WithSignatureVersion("siderov0"))
+
+		assert.Error(t, m.Sign("test@example.com", mockSignerVerifier{}))
+	})
+}
+
+func TestGRPCSignedHeaders(t *testing.T) {
+	t.Parallel()
+
+	sign := func(t *testing.T, opts ...message.Option) metadata.MD {
+		m := message.NewGRPC(metadata.Pairs("cluster", "foo", "x-route", "bar"), "some.method.Name", opts...)
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		return m.Metadata
+	}
+
+	verify := func(md metadata.MD, opts ...message.Option) error {
+		return message.NewGRPC(md, "some.method.Name", opts...).VerifySignature(mockSignerVerifier{})
+	}
+
+	t.Run("additional", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t, message.WithAdditionalSignedHeaders("X-Route"))
+
+		p, err := message.ParseGRPCPayload([]byte(md.Get(message.PayloadHeaderKey)[0]))
+		require.NoError(t, err)
+
+		assert.Contains(t, p.SignedHeaders(), "x-route")
+		assert.Contains(t, p.SignedHeaders(), message.ClusterHeaderKey)
+
+		require.NoError(t, verify(md.Copy()))
+		require.NoError(t, verify(md.Copy(), message.WithAdditionalSignedHeaders("x-route")))
+
+		// headers covered by the signer are verified even if the verifier doesn't require them
+		mdCopy := md.Copy()
+		mdCopy.Set("x-route", "baz")
+
+		require.Error(t, verify(mdCopy))
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t, message.WithSignedHeaders("x-route"))
+
+		p, err := message.ParseGRPCPayload([]byte(md.Get(message.PayloadHeaderKey)[0]))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"x-route", message.NonceHeaderKey, message.TimestampHeaderKey}, p.SignedHeaders())
+
+		require.NoError(t, verify(md.Copy(), message.WithSignedHeaders("x-route")))
+
+		// the verifier requires the default headers, cluster header is not covered by the signature
+		require.Error(t, verify(md.Copy()))
+	})
+
+	t.Run("not covered by the signer", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t)
+
+		require.NoError(t, verify(md.Copy()))
+		require.Error(t, verify(md.Copy(), message.WithAdditionalSignedHeaders("x-route")))
+	})
+}
+
+func TestGRPCClock(t *testing.T) {
+	t.Parallel()
+
+	signedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := message.NewGRPC(metadata.Pairs(), "some.method.Name", message.WithClock(func() time.Time { return signedAt }))
+
+	require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+	assert.Equal(t, []string{strconv.FormatInt(signedAt.Unix(), 10)}, m.Metadata.Get(message.TimestampHeaderKey))
+
+	verify := func(now time.Time, opts ...message.Option) error {
+		return message.NewGRPC(m.Metadata.Copy(), "some.method.Name", append(opts, message.WithClock(func() time.Time { return now }))...).
+			VerifySignature(mockSignerVerifier{})
+	}
+
+	assert.NoError(t, verify(signedAt.Add(message.DefaultAllowedClockSkew)))
+	assert.Error(t, verify(signedAt.Add(message.DefaultAllowedClockSkew+time.Second)))
+	assert.Error(t, verify(signedAt.Add(-message.DefaultAllowedClockSkew-time.Second)))
+
+	assert.NoError(t, verify(signedAt.Add(30*time.Second), message.WithAllowedClockSkew(time.Minute)))
+	assert.Error(t, verify(signedAt.Add(2*time.Minute), message.WithAllowedClockSkew(time.Minute)))
+}
+
+func TestGRPCClockReplay(t *testing.T) {
+	t.Parallel()
+
+	// the clock is far in the past of the system time
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := message.WithClock(func() time.Time { return now })
+
+	m := message.NewGRPC(metadata.Pairs(), "some.method.Name", clock)
+
+	require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+	store := message.NewMemoryReplayStore()
+
+	verify := func() error {
+		return message.NewGRPC(m.Metadata.Copy(), "some.method.Name", clock, message.WithReplayStore(store)).
+			VerifySignature(mockSignerVerifier{})
+	}
+
+	require.NoError(t, verify())
+	assert.ErrorIs(t, verify(), message.ErrReplayedSignature)
+}
@@ -6,10 +6,8 @@ package message
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -17,31 +15,44 @@ import (
 	"time"
 )
 
-// DoS Protection.
-const maxBodySize = 1024 * 1024
-
 // HTTP represents a gRPC message.
 type HTTP struct {
 	request *http.Request
 	options Options
 	body    []byte
+
+	// bodyDigest is the SHA-256 digest of the body which is not buffered in the streaming mode.
+	bodyDigest []byte
+	streaming  bool
 }
 
 // NewHTTP returns a new HTTP message.
+//
+// The request body is buffered in memory up to the limit set by WithMaxBodySize, see WithStreamingBody for the large bodies.
 func NewHTTP(r *http.Request, options ...Option) (*HTTP, error) {
-	var (
-		bodyBytes []byte
-		err       error
-		opts      Options
-	)
+	var opts Options
 
 	for _, option := range options {
 		option(&opts)
 	}
 
+	if opts.StreamingBody {
+		return newStreamingHTTP(r, opts)
+	}
+
+	return newBufferedHTTP(r, opts)
+}
+
+func newBufferedHTTP(r *http.Request, opts Options) (*HTTP, error) {
+	var bodyBytes []byte
+
 	if r.Body != nil {
-		bodyBytes, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+		var err error
+
+		bodyBytes, err = readBody(r.Body, opts.maxBodySize())
 		if err != nil {
+			r.Body.Close() //nolint:errcheck
+
 			return nil, err
 		}
 
@@ -66,12 +77,45 @@ func (m *HTTP) timestamp() (*time.Time, error) {
 
 // Signature returns the signature on the message.
 func (m *HTTP) Signature() (*Signature, error) {
+	if m.isHTTPMessageSignature() {
+		signature, _, err := m.httpMessageSignature()
+		if err != nil {
+			return nil, checkMissingSignature(err, m.options.SignatureRequiredCheck)
+		}
+
+		return signature, nil
+	}
+
 	return parseSignature(m.request.Header.Get(SignatureHeaderKey), m.options.SignatureRequiredCheck) //nolint:canonicalheader
 }
 
 // Sign signs the message with the given signer for SignatureVersionV1.
+//
+// If WithHTTPMessageSignatures is set, the message is signed using RFC 9421 HTTP Message Signatures instead.
 func (m *HTTP) Sign(identity string, signer Signer) error {
-	m.request.Header.Set(TimestampHeaderKey, strconv.FormatInt(time.Now().Unix(), 10)) //nolint:canonicalheader
+	if m.streaming {
+		if err := m.digestBody(); err != nil {
+			return err
+		}
+
+		m.request.Header.Set(ContentDigestHeaderKey, formatContentDigest(m.bodyDigest))
+	}
+
+	if m.options.HTTPMessageSignatures {
+		return m.signHTTPMessageSignature(identity, signer)
+	}
+
+	m.request.Header.Set(TimestampHeaderKey, strconv.FormatInt(m.options.now().Unix(), 10)) //nolint:canonicalheader
+	m.request.Header.Del(NonceHeaderKey)                                                    //nolint:canonicalheader
+
+	if m.options.Nonce {
+		nonce, err := generateNonce()
+		if err != nil {
+			return err
+		}
+
+		m.request.Header.Set(NonceHeaderKey, nonce) //nolint:canonicalheader
+	}
 
 	payload, err := m.payload()
 	if err != nil {
@@ -83,23 +127,36 @@ func (m *HTTP) Sign(identity string, signer Signer) error {
 		return err
 	}
 
-	signatureBase64 := base64.StdEncoding.EncodeToString(signature)
+	signatureHeader, err := FormatSignatureHeader(&Signature{
+		Version:        SignatureVersionV1,
+		Identity:       identity,
+		KeyFingerprint: signer.Fingerprint(),
+		Signature:      signature,
+	})
+	if err != nil {
+		return err
+	}
 
-	//nolint:canonicalheader
-	m.request.Header.Set(SignatureHeaderKey, fmt.Sprintf("%s %s %s %s", SignatureVersionV1, identity, signer.Fingerprint(), signatureBase64))
+	m.request.Header.Set(SignatureHeaderKey, signatureHeader) //nolint:canonicalheader
 
 	return nil
 }
 
 // VerifySignature verifies the signature of the message.
 // It includes the verifications for the timestamp and the payload.
+//
+// RFC 9421 HTTP Message Signatures are verified if the request has no SignatureVersionV1 signature.
 func (m *HTTP) VerifySignature(verifier SignatureVerifier) error {
+	if m.isHTTPMessageSignature() {
+		return m.verifyHTTPMessageSignature(verifier)
+	}
+
 	timestamp, err := m.timestamp()
 	if err != nil {
 		return err
 	}
 
-	err = verifyTimestamp(timestamp)
+	err = verifyTimestamp(timestamp, &m.options)
 	if err != nil {
 		return err
 	}
@@ -114,7 +171,32 @@ func (m *HTTP) VerifySignature(verifier SignatureVerifier) error {
 		return err
 	}
 
-	return verifier.Verify(payload, signature.Signature)
+	if err = verifier.Verify(payload, signature.Signature); err != nil {
+		return verificationErrorf(ReasonBadSignature, "", "%w", err)
+	}
+
+	return checkReplay(&m.options, signature, m.request.Header.Get(NonceHeaderKey), timestamp) //nolint:canonicalheader
+}
+
+// VerifyWith resolves the signing key using the resolver and verifies the signature of the message.
+//
+// The verified signature is returned on success.
+func (m *HTTP) VerifyWith(ctx context.Context, resolver KeyResolver) (*Signature, error) {
+	signature, err := m.Signature()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := resolveVerifier(ctx, resolver, signature, &m.options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.VerifySignature(verifier); err != nil {
+		return nil, err
+	}
+
+	return signature, nil
 }
 
 func (m *HTTP) payload() ([]byte, error) {
@@ -125,16 +207,25 @@ func (m *HTTP) payload() ([]byte, error) {
 
 	timestampStr := strconv.FormatInt(timestamp.Unix(), 10)
 
-	bodySHA256 := sha256.Sum256(m.body)
-	bodySHA256Hex := hex.EncodeToString(bodySHA256[:])
+	bodySHA256Hex := hex.EncodeToString(m.bodySHA256())
 
-	requestURI := m.request.RequestURI
-	if requestURI == "" {
-		// client request
-		requestURI = m.request.URL.RequestURI()
+	parts := []string{m.request.Method, m.requestURI(), timestampStr, bodySHA256Hex}
+
+	// the nonce is only a part of the payload if present to keep the payload compatible with the older verifiers
+	if nonce := m.request.Header.Get(NonceHeaderKey); nonce != "" { //nolint:canonicalheader
+		parts = append(parts, nonce)
 	}
 
-	payload := strings.Join([]string{m.request.Method, requestURI, timestampStr, bodySHA256Hex}, "\n")
+	payload := strings.Join(parts, "\n")
 
 	return []byte(payload), nil
 }
+
+func (m *HTTP) requestURI() string {
+	if m.request.RequestURI == "" {
+		// client request
+		return m.request.URL.RequestURI()
+	}
+
+	return m.request.RequestURI
+}
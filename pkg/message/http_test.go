@@ -9,6 +9,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
 	"time"
@@ -169,3 +170,186 @@ func TestHTTPMessageSignatures(t *testing.T) {
 		require.ErrorIs(t, err, message.ErrNotFound)
 	})
 }
+
+func TestHTTPReplay(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name  string
+		nonce bool
+	}{
+		{
+			name:  "signature",
+			nonce: false,
+		},
+		{
+			name:  "nonce",
+			nonce: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := message.NewMemoryReplayStore()
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "/some/path", bytes.NewReader([]byte("body")))
+			require.NoError(t, err)
+
+			m, err := message.NewHTTP(req, message.WithNonce(tt.nonce))
+			require.NoError(t, err)
+
+			require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+			if tt.nonce {
+				assert.NotEmpty(t, req.Header.Get(message.NonceHeaderKey))
+			} else {
+				assert.Empty(t, req.Header.Get(message.NonceHeaderKey))
+			}
+
+			verify := func() error {
+				reqCopy := req.Clone(t.Context())
+				reqCopy.Body = io.NopCloser(bytes.NewReader([]byte("body")))
+
+				mCopy, err := message.NewHTTP(reqCopy, message.WithReplayStore(store))
+				require.NoError(t, err)
+
+				return mCopy.VerifySignature(mockSignerVerifier{})
+			}
+
+			require.NoError(t, verify())
+			require.ErrorIs(t, verify(), message.ErrReplayedSignature)
+		})
+	}
+}
+
+func TestHTTPBodyTooLarge(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("a"), message.DefaultMaxBodySize+1)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "/some/path", bytes.NewReader(body))
+	require.NoError(t, err)
+
+	_, err = message.NewHTTP(req)
+	require.ErrorIs(t, err, message.ErrBodyTooLarge)
+
+	req, err = http.NewRequestWithContext(t.Context(), http.MethodPost, "/some/path", bytes.NewReader(body))
+	require.NoError(t, err)
+
+	_, err = message.NewHTTP(req, message.WithMaxBodySize(-1))
+	require.NoError(t, err)
+}
+
+func TestHTTPStreamingBody(t *testing.T) {
+	t.Parallel()
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), message.DefaultMaxBodySize/8)
+
+	sign := func(t *testing.T, opts ...message.Option) *http.Request {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://example.com/some/path", bytes.NewReader(body))
+		require.NoError(t, err)
+
+		m, err := message.NewHTTP(req, append(opts, message.WithStreamingBody(true))...)
+		require.NoError(t, err)
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		assert.NotEmpty(t, req.Header.Get(message.ContentDigestHeaderKey))
+
+		return req
+	}
+
+	receive := func(t *testing.T, req *http.Request, receivedBody []byte) *http.Request {
+		serverReq := httptest.NewRequestWithContext(t.Context(), req.Method, req.URL.RequestURI(), bytes.NewReader(receivedBody))
+		serverReq.Host = req.URL.Host
+		serverReq.Header = req.Header.Clone()
+
+		return serverReq
+	}
+
+	for _, tt := range []struct {
+		name         string
+		receivedBody []byte
+		opts         []message.Option
+		serverOpts   []message.Option
+		expectedErr  error
+	}{
+		{
+			name:         "valid",
+			receivedBody: body,
+		},
+		{
+			name:         "valid RFC 9421",
+			receivedBody: body,
+			opts:         []message.Option{message.WithHTTPMessageSignatures(true)},
+		},
+		{
+			name:         "tampered",
+			receivedBody: append(bytes.Clone(body[:len(body)-1]), 'x'),
+			expectedErr:  message.ErrBodyDigestMismatch,
+		},
+		{
+			name:         "truncated",
+			receivedBody: body[:message.DefaultMaxBodySize],
+			expectedErr:  message.ErrBodyDigestMismatch,
+		},
+		{
+			name:         "limit",
+			receivedBody: body,
+			serverOpts:   []message.Option{message.WithMaxBodySize(message.DefaultMaxBodySize)},
+			expectedErr:  message.ErrBodyTooLarge,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			serverReq := receive(t, sign(t, tt.opts...), tt.receivedBody)
+
+			m, err := message.NewHTTP(serverReq, append(tt.serverOpts, message.WithStreamingBody(true))...)
+			require.NoError(t, err)
+
+			// the signature covers the digest, so it is valid until the body is read
+			require.NoError(t, m.VerifySignature(mockSignerVerifier{}))
+
+			receivedBody, err := io.ReadAll(serverReq.Body)
+
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, body, receivedBody)
+		})
+	}
+
+	t.Run("tampered digest", func(t *testing.T) {
+		t.Parallel()
+
+		req := sign(t)
+		req.Header.Set(message.ContentDigestHeaderKey, "sha-256=:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=:")
+
+		m, err := message.NewHTTP(receive(t, req, body), message.WithStreamingBody(true))
+		require.NoError(t, err)
+
+		require.Error(t, m.VerifySignature(mockSignerVerifier{}))
+	})
+
+	t.Run("buffered client", func(t *testing.T) {
+		t.Parallel()
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://example.com/some/path", bytes.NewReader([]byte("body")))
+		require.NoError(t, err)
+
+		m, err := message.NewHTTP(req)
+		require.NoError(t, err)
+
+		require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+		m, err = message.NewHTTP(receive(t, req, []byte("body")), message.WithStreamingBody(true))
+		require.NoError(t, err)
+
+		require.NoError(t, m.VerifySignature(mockSignerVerifier{}))
+	})
+}
@@ -0,0 +1,520 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RFC 9421 HTTP Message Signatures headers.
+const (
+	// SignatureInputHeaderKey is the header name for the signature metadata.
+	SignatureInputHeaderKey = "Signature-Input"
+
+	// HTTPSignatureHeaderKey is the header name for the signature.
+	HTTPSignatureHeaderKey = "Signature"
+
+	// ContentDigestHeaderKey is the header name for the RFC 9530 request body digest.
+	ContentDigestHeaderKey = "Content-Digest"
+
+	// HTTPSignatureLabel is the label of the signature in the Signature-Input and Signature headers.
+	HTTPSignatureLabel = "sidero"
+)
+
+// SignatureVersionHTTPMessageSignatures is the version reported for the RFC 9421 HTTP message signatures.
+//
+// It is never sent in the signature headers.
+const SignatureVersionHTTPMessageSignatures SignatureVersion = "rfc9421"
+
+// coveredComponents are the components covered by the HTTP message signatures.
+//
+// The scheme is not covered, as it is not known to the servers behind the TLS-terminating proxies.
+var coveredComponents = []string{"@method", "@authority", "@path", "@query", "content-digest"}
+
+// httpSignatureInput represents the parsed Signature-Input header member.
+type httpSignatureInput struct {
+	params     map[string]string
+	raw        string
+	components []string
+}
+
+func (m *HTTP) isHTTPMessageSignature() bool {
+	//nolint:canonicalheader
+	return m.request.Header.Get(SignatureHeaderKey) == "" && m.request.Header.Get(SignatureInputHeaderKey) != ""
+}
+
+func (m *HTTP) signHTTPMessageSignature(identity string, signer Signer) error {
+	// if the request is re-signed, remove the signature headers which might be already present
+	m.request.Header.Del(SignatureHeaderKey) //nolint:canonicalheader
+	m.request.Header.Del(TimestampHeaderKey) //nolint:canonicalheader
+	m.request.Header.Del(NonceHeaderKey)     //nolint:canonicalheader
+
+	m.request.Header.Set(ContentDigestHeaderKey, formatContentDigest(m.bodySHA256()))
+
+	identityParam, err := serializeString(identity)
+	if err != nil {
+		return fmt.Errorf("invalid identity: %w", err)
+	}
+
+	fingerprintParam, err := serializeString(signer.Fingerprint())
+	if err != nil {
+		return fmt.Errorf("invalid fingerprint: %w", err)
+	}
+
+	var input strings.Builder
+
+	input.WriteString("(")
+
+	for i, component := range coveredComponents {
+		if i > 0 {
+			input.WriteString(" ")
+		}
+
+		input.WriteString(strconv.Quote(component))
+	}
+
+	fmt.Fprintf(&input, ");created=%d;keyid=%s;identity=%s", m.options.now().Unix(), fingerprintParam, identityParam)
+
+	if m.options.Nonce {
+		nonce, nonceErr := generateNonce()
+		if nonceErr != nil {
+			return nonceErr
+		}
+
+		fmt.Fprintf(&input, ";nonce=%q", nonce)
+	}
+
+	signatureInput := httpSignatureInput{
+		raw:        input.String(),
+		components: coveredComponents,
+	}
+
+	base, err := m.signatureBase(&signatureInput)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signer.Sign(base)
+	if err != nil {
+		return err
+	}
+
+	m.request.Header.Set(SignatureInputHeaderKey, HTTPSignatureLabel+"="+signatureInput.raw)
+	m.request.Header.Set(HTTPSignatureHeaderKey, HTTPSignatureLabel+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+
+	return nil
+}
+
+func (m *HTTP) httpMessageSignature() (*Signature, *httpSignatureInput, error) {
+	inputs, err := parseDictionary(m.request.Header.Get(SignatureInputHeaderKey))
+	if err != nil {
+		return nil, nil, verificationErrorf(ReasonMalformedHeader, SignatureInputHeaderKey, "invalid %s header: %w", SignatureInputHeaderKey, err)
+	}
+
+	rawInput, ok := inputs[HTTPSignatureLabel]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s %q", ErrNotFound, SignatureInputHeaderKey, HTTPSignatureLabel)
+	}
+
+	input, err := parseInnerList(rawInput)
+	if err != nil {
+		return nil, nil, verificationErrorf(ReasonMalformedHeader, SignatureInputHeaderKey, "invalid %s header: %w", SignatureInputHeaderKey, err)
+	}
+
+	signatures, err := parseDictionary(m.request.Header.Get(HTTPSignatureHeaderKey))
+	if err != nil {
+		return nil, nil, verificationErrorf(ReasonMalformedHeader, HTTPSignatureHeaderKey, "invalid %s header: %w", HTTPSignatureHeaderKey, err)
+	}
+
+	rawSignature, ok := signatures[HTTPSignatureLabel]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s %q", ErrNotFound, HTTPSignatureHeaderKey, HTTPSignatureLabel)
+	}
+
+	if len(rawSignature) < 2 || rawSignature[0] != ':' || rawSignature[len(rawSignature)-1] != ':' {
+		return nil, nil, verificationErrorf(ReasonMalformedHeader, HTTPSignatureHeaderKey, "invalid %s header: signature is not a byte sequence", HTTPSignatureHeaderKey)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(rawSignature[1 : len(rawSignature)-1])
+	if err != nil {
+		return nil, nil, verificationErrorf(ReasonMalformedHeader, HTTPSignatureHeaderKey, "invalid %s header: %w", HTTPSignatureHeaderKey, err)
+	}
+
+	return &Signature{
+		Version:        SignatureVersionHTTPMessageSignatures,
+		Identity:       input.params["identity"],
+		KeyFingerprint: input.params["keyid"],
+		Signature:      signature,
+	}, input, nil
+}
+
+func (m *HTTP) verifyHTTPMessageSignature(verifier SignatureVerifier) error {
+	signature, input, err := m.httpMessageSignature()
+	if err != nil {
+		return err
+	}
+
+	for _, component := range coveredComponents {
+		if !slices.Contains(input.components, component) {
+			return verificationErrorf(ReasonMalformedHeader, SignatureInputHeaderKey, "required component is not covered by the signature: %s", component)
+		}
+	}
+
+	if signature.KeyFingerprint == "" {
+		return verificationErrorf(ReasonMalformedHeader, SignatureInputHeaderKey, "%w: keyid", ErrNotFound)
+	}
+
+	timestamp, err := parseTimestamp(input.params["created"])
+	if err != nil {
+		return err
+	}
+
+	if err = verifyTimestamp(timestamp, &m.options); err != nil {
+		return err
+	}
+
+	digest, err := parseContentDigest(m.request.Header.Get(ContentDigestHeaderKey))
+	if err != nil {
+		return verificationErrorf(ReasonMalformedHeader, ContentDigestHeaderKey, "%w", err)
+	}
+
+	if !bytes.Equal(digest, m.bodySHA256()) {
+		return verificationErrorf(ReasonBodyMismatch, ContentDigestHeaderKey, "%s does not match the request body", ContentDigestHeaderKey)
+	}
+
+	base, err := m.signatureBase(input)
+	if err != nil {
+		return verificationErrorf(ReasonMalformedHeader, SignatureInputHeaderKey, "%w", err)
+	}
+
+	if err = verifier.Verify(base, signature.Signature); err != nil {
+		return verificationErrorf(ReasonBadSignature, "", "%w", err)
+	}
+
+	return checkReplay(&m.options, signature, input.params["nonce"], timestamp)
+}
+
+// signatureBase builds the RFC 9421 signature base for the covered components.
+func (m *HTTP) signatureBase(input *httpSignatureInput) ([]byte, error) {
+	var base bytes.Buffer
+
+	for _, component := range input.components {
+		value, err := m.componentValue(component)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&base, "%q: %s\n", component, value)
+	}
+
+	fmt.Fprintf(&base, "%q: %s", "@signature-params", input.raw)
+
+	return base.Bytes(), nil
+}
+
+func (m *HTTP) componentValue(component string) (string, error) {
+	switch component {
+	case "@method":
+		return m.request.Method, nil
+	case "@target-uri":
+		return m.targetURI(), nil
+	case "@authority":
+		return m.authority(), nil
+	case "@path":
+		return m.request.URL.EscapedPath(), nil
+	case "@query":
+		return "?" + m.request.URL.RawQuery, nil
+	case "@request-target":
+		return m.requestURI(), nil
+	}
+
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("unsupported derived component: %s", component)
+	}
+
+	values := m.request.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, component)
+	}
+
+	trimmed := make([]string, 0, len(values))
+
+	for _, value := range values {
+		trimmed = append(trimmed, strings.TrimSpace(value))
+	}
+
+	return strings.Join(trimmed, ", "), nil
+}
+
+// targetURI reconstructs the absolute target URI of the request.
+//
+// On the server side, the scheme is derived from the TLS connection state.
+func (m *HTTP) targetURI() string {
+	scheme := m.request.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+
+		if m.request.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	return scheme + "://" + m.authority() + m.request.URL.RequestURI()
+}
+
+func (m *HTTP) authority() string {
+	if m.options.HTTPAuthority != "" {
+		return strings.ToLower(m.options.HTTPAuthority)
+	}
+
+	host := m.request.Host
+	if host == "" {
+		host = m.request.URL.Host
+	}
+
+	return strings.ToLower(host)
+}
+
+func formatContentDigest(digest []byte) string {
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(digest) + ":"
+}
+
+// parseContentDigest returns the SHA-256 digest from the Content-Digest header, other algorithms are ignored.
+func parseContentDigest(value string) ([]byte, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, ContentDigestHeaderKey)
+	}
+
+	digests, err := parseDictionary(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", ContentDigestHeaderKey, err)
+	}
+
+	rawDigest, ok := digests["sha-256"]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s sha-256", ErrNotFound, ContentDigestHeaderKey)
+	}
+
+	if len(rawDigest) < 2 || rawDigest[0] != ':' || rawDigest[len(rawDigest)-1] != ':' {
+		return nil, fmt.Errorf("invalid %s header: digest is not a byte sequence", ContentDigestHeaderKey)
+	}
+
+	digest, err := base64.StdEncoding.DecodeString(rawDigest[1 : len(rawDigest)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", ContentDigestHeaderKey, err)
+	}
+
+	if len(digest) != sha256.Size {
+		return nil, fmt.Errorf("invalid %s header: unexpected sha-256 digest length %d", ContentDigestHeaderKey, len(digest))
+	}
+
+	return digest, nil
+}
+
+// parseDictionary parses a structured field dictionary into the raw member values.
+//
+// Only the subset of RFC 8941 used by the HTTP message signatures is supported.
+func parseDictionary(value string) (map[string]string, error) {
+	members := map[string]string{}
+
+	var (
+		depth    int
+		inString bool
+		escaped  bool
+		start    int
+	)
+
+	addMember := func(member string) error {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			return nil
+		}
+
+		key, memberValue, ok := strings.Cut(member, "=")
+		if !ok {
+			return fmt.Errorf("invalid dictionary member: %q", member)
+		}
+
+		members[strings.TrimSpace(key)] = strings.TrimSpace(memberValue)
+
+		return nil
+	}
+
+	for i := range len(value) {
+		c := value[i]
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			if err := addMember(value[start:i]); err != nil {
+				return nil, err
+			}
+
+			start = i + 1
+		}
+	}
+
+	if inString || depth != 0 {
+		return nil, fmt.Errorf("unterminated dictionary member")
+	}
+
+	if err := addMember(value[start:]); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// parseInnerList parses an inner list of strings with parameters, e.g. `("@method" "@target-uri");created=1;keyid="foo"`.
+func parseInnerList(value string) (*httpSignatureInput, error) {
+	input := &httpSignatureInput{
+		raw:    value,
+		params: map[string]string{},
+	}
+
+	if !strings.HasPrefix(value, "(") {
+		return nil, fmt.Errorf("inner list expected")
+	}
+
+	rest := value[1:]
+
+	for {
+		rest = strings.TrimLeft(rest, " ")
+
+		if strings.HasPrefix(rest, ")") {
+			rest = rest[1:]
+
+			break
+		}
+
+		item, remainder, err := parseString(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		input.components = append(input.components, item)
+		rest = remainder
+	}
+
+	for rest != "" {
+		if rest[0] != ';' {
+			return nil, fmt.Errorf("parameter expected: %q", rest)
+		}
+
+		rest = strings.TrimLeft(rest[1:], " ")
+
+		end := strings.IndexAny(rest, "=;")
+		if end == -1 {
+			end = len(rest)
+		}
+
+		key := rest[:end]
+		rest = rest[end:]
+
+		if !strings.HasPrefix(rest, "=") {
+			// boolean parameter
+			input.params[key] = "?1"
+
+			continue
+		}
+
+		rest = rest[1:]
+
+		if strings.HasPrefix(rest, `"`) {
+			paramValue, remainder, err := parseString(rest)
+			if err != nil {
+				return nil, err
+			}
+
+			input.params[key] = paramValue
+			rest = remainder
+
+			continue
+		}
+
+		end = strings.IndexByte(rest, ';')
+		if end == -1 {
+			end = len(rest)
+		}
+
+		input.params[key] = rest[:end]
+		rest = rest[end:]
+	}
+
+	return input, nil
+}
+
+// parseString parses a structured field string from the beginning of the value.
+func parseString(value string) (string, string, error) {
+	if !strings.HasPrefix(value, `"`) {
+		return "", "", fmt.Errorf("string expected: %q", value)
+	}
+
+	var result strings.Builder
+
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			i++
+
+			if i == len(value) || (value[i] != '"' && value[i] != '\\') {
+				return "", "", fmt.Errorf("invalid escape in string: %q", value)
+			}
+
+			result.WriteByte(value[i])
+		case '"':
+			return result.String(), value[i+1:], nil
+		default:
+			if c < 0x20 || c > 0x7e {
+				return "", "", fmt.Errorf("invalid character in string: %q", value)
+			}
+
+			result.WriteByte(c)
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated string: %q", value)
+}
+
+// serializeString serializes the value as a structured field string.
+func serializeString(value string) (string, error) {
+	var result strings.Builder
+
+	result.WriteByte('"')
+
+	for i := range len(value) {
+		c := value[i]
+
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("invalid character in string: %q", value)
+		}
+
+		if c == '"' || c == '\\' {
+			result.WriteByte('\\')
+		}
+
+		result.WriteByte(c)
+	}
+
+	result.WriteByte('"')
+
+	return result.String(), nil
+}
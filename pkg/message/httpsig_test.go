@@ -0,0 +1,281 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+func TestHTTPRFC9421(t *testing.T) {
+	const (
+		body     = "hello world"
+		target   = "https://example.com/some/path?foo=bar"
+		identity = "test@example.com"
+	)
+
+	req, err := http.NewRequestWithContext(context.TODO(), http.MethodPut, target, bytes.NewReader([]byte(body)))
+	require.NoError(t, err)
+
+	m, err := message.NewHTTP(req, message.WithHTTPMessageSignatures(true))
+	require.NoError(t, err)
+
+	require.NoError(t, m.Sign(identity, mockSignerVerifier{}))
+
+	assert.Empty(t, req.Header.Get(message.SignatureHeaderKey))
+	assert.Empty(t, req.Header.Get(message.TimestampHeaderKey))
+	assert.Equal(t, "sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:", req.Header.Get(message.ContentDigestHeaderKey))
+	assert.Regexp(t,
+		regexp.MustCompile(`^sidero=\("@method" "@authority" "@path" "@query" "content-digest"\);created=\d+;keyid="mock-fingerprint";identity="test@example.com"$`),
+		req.Header.Get(message.SignatureInputHeaderKey),
+	)
+	assert.Regexp(t, regexp.MustCompile(`^sidero=:[A-Za-z0-9+/=]+:$`), req.Header.Get(message.HTTPSignatureHeaderKey))
+
+	// server-side request
+	serverRequest := func() *http.Request {
+		serverReq := httptest.NewRequest(http.MethodPut, "/some/path?foo=bar", bytes.NewReader([]byte(body)))
+		serverReq.Host = "example.com"
+		serverReq.TLS = &tls.ConnectionState{}
+		serverReq.Header = req.Header.Clone()
+
+		return serverReq
+	}
+
+	for _, tt := range []struct {
+		mutator       func(*testing.T, *http.Request)
+		name          string
+		expectFailure bool
+	}{
+		{
+			name:    "no changes",
+			mutator: func(*testing.T, *http.Request) {},
+		},
+		{
+			name: "not covered header",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Set("foo", "bar") //nolint:canonicalheader
+			},
+		},
+		{
+			name: "additional signature",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Set(message.SignatureInputHeaderKey, `proxy=("@method");created=1, `+req.Header.Get(message.SignatureInputHeaderKey))
+				req.Header.Set(message.HTTPSignatureHeaderKey, req.Header.Get(message.HTTPSignatureHeaderKey)+`, proxy=:Zm9v:`)
+			},
+		},
+		{
+			name: "method",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Method = http.MethodPost
+			},
+			expectFailure: true,
+		},
+		{
+			name: "plain HTTP",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.TLS = nil
+			},
+		},
+		{
+			name: "host",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Host = "example.org"
+			},
+			expectFailure: true,
+		},
+		{
+			name: "path",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.URL.Path = "/some/other/path"
+			},
+			expectFailure: true,
+		},
+		{
+			name: "query",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.URL.RawQuery = "foo=baz"
+			},
+			expectFailure: true,
+		},
+		{
+			name: "body",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Body = io.NopCloser(bytes.NewReader([]byte("goodbye world")))
+			},
+			expectFailure: true,
+		},
+		{
+			name: "content digest",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Set(message.ContentDigestHeaderKey, "sha-256=:Zm9v:")
+			},
+			expectFailure: true,
+		},
+		{
+			name: "corrupt signature",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Set(message.HTTPSignatureHeaderKey, "sidero=:Zm9v:")
+			},
+			expectFailure: true,
+		},
+		{
+			name: "expired",
+			mutator: func(_ *testing.T, req *http.Request) {
+				input := req.Header.Get(message.SignatureInputHeaderKey)
+				input = regexp.MustCompile(`created=\d+`).ReplaceAllString(input, "created="+strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+
+				req.Header.Set(message.SignatureInputHeaderKey, input)
+			},
+			expectFailure: true,
+		},
+		{
+			name: "content digest not covered",
+			mutator: func(_ *testing.T, req *http.Request) {
+				input := req.Header.Get(message.SignatureInputHeaderKey)
+				input = regexp.MustCompile(` "content-digest"`).ReplaceAllString(input, "")
+
+				req.Header.Set(message.SignatureInputHeaderKey, input)
+			},
+			expectFailure: true,
+		},
+		{
+			name: "drop signature",
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Del(message.HTTPSignatureHeaderKey)
+			},
+			expectFailure: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			serverReq := serverRequest()
+
+			tt.mutator(t, serverReq)
+
+			mCopy, err := message.NewHTTP(serverReq)
+			require.NoError(t, err)
+
+			if tt.expectFailure {
+				assert.Error(t, mCopy.VerifySignature(mockSignerVerifier{}))
+
+				return
+			}
+
+			require.NoError(t, mCopy.VerifySignature(mockSignerVerifier{}))
+
+			signature, err := mCopy.Signature()
+			require.NoError(t, err)
+
+			assert.Equal(t, message.SignatureVersionHTTPMessageSignatures, signature.Version)
+			assert.Equal(t, identity, signature.Identity)
+			assert.Equal(t, "mock-fingerprint", signature.KeyFingerprint)
+		})
+	}
+}
+
+func TestHTTPRFC9421Proxy(t *testing.T) {
+	var verifyOptions []message.Option
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, err := message.NewHTTP(r, verifyOptions...)
+		if err == nil {
+			err = m.VerifySignature(mockSignerVerifier{})
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(backend.Close)
+
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		name          string
+		verifyOptions func(frontendURL *url.URL) []message.Option
+		preserveHost  bool
+		expectFailure bool
+	}{
+		{
+			name:         "TLS-terminating proxy",
+			preserveHost: true,
+		},
+		{
+			name:          "rewritten host",
+			expectFailure: true,
+		},
+		{
+			name: "rewritten host with authority",
+			verifyOptions: func(frontendURL *url.URL) []message.Option {
+				return []message.Option{message.WithHTTPAuthority(frontendURL.Host)}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			frontend := httptest.NewTLSServer(&httputil.ReverseProxy{
+				Rewrite: func(r *httputil.ProxyRequest) {
+					r.SetURL(backendURL)
+
+					if tt.preserveHost {
+						r.Out.Host = r.In.Host
+					}
+				},
+			})
+			t.Cleanup(frontend.Close)
+
+			frontendURL, err := url.Parse(frontend.URL)
+			require.NoError(t, err)
+
+			verifyOptions = nil
+
+			if tt.verifyOptions != nil {
+				verifyOptions = tt.verifyOptions(frontendURL)
+			}
+
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, frontend.URL+"/some/path?foo=bar", bytes.NewReader([]byte("hello world")))
+			require.NoError(t, err)
+
+			m, err := message.NewHTTP(req, message.WithHTTPMessageSignatures(true))
+			require.NoError(t, err)
+
+			require.NoError(t, m.Sign("test@example.com", mockSignerVerifier{}))
+
+			resp, err := frontend.Client().Do(req)
+			require.NoError(t, err)
+
+			defer resp.Body.Close() //nolint:errcheck
+
+			respBody, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			if tt.expectFailure {
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+				return
+			}
+
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode, string(respBody))
+		})
+	}
+}
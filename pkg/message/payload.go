@@ -5,14 +5,20 @@
 package message
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"slices"
 
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 )
 
 var includedHeaders = []string{
 	TimestampHeaderKey,
+	NonceHeaderKey,
 	NodesHeaderKey,
 	SelectorsHeaderKey,
 	FieldSelectorsHeaderKey,
@@ -29,10 +35,22 @@ var includedHeaders = []string{
 // Its JSON representation is added to the GRPC metadata.
 // On signature verification, the signature is verified against the JSON representation of the payload.
 // The payload itself is verified against the actual GRPC message.
+//
+// The keys of Headers are the set of the signed headers, including the ones which were not present in the metadata.
 type GRPCPayload struct {
 	Headers map[string][]string `json:"headers,omitempty"`
 	Method  string              `json:"method"`
 
+	// Version is the signature version, it is only set in SignatureVersionV2 (for compatibility with the older verifiers).
+	//
+	// The version in the signature header is not signed, so it is verified against the payload.
+	Version SignatureVersion `json:"version,omitempty"`
+
+	// BodyDigest is the hex-encoded SHA-256 digest of the request message, it is only set in SignatureVersionV2.
+	//
+	// It is verified whenever it is present, regardless of the signature version.
+	BodyDigest string `json:"body_digest,omitempty"`
+
 	originalJSON []byte
 }
 
@@ -53,9 +71,16 @@ func ParseGRPCPayload(payloadJSON []byte) (*GRPCPayload, error) {
 //
 // This method is used in the signing flow.
 func BuildGRPCPayload(md metadata.MD, method string) *GRPCPayload {
-	headers := make(map[string][]string)
+	return BuildGRPCPayloadWithHeaders(md, method, includedHeaders)
+}
 
-	for _, header := range includedHeaders {
+// BuildGRPCPayloadWithHeaders builds the payload based on the request metadata covering the given set of headers.
+//
+// This method is used in the signing flow.
+func BuildGRPCPayloadWithHeaders(md metadata.MD, method string, signedHeaders []string) *GRPCPayload {
+	headers := make(map[string][]string, len(signedHeaders))
+
+	for _, header := range signedHeaders {
 		headers[header] = md.Get(header)
 	}
 
@@ -65,6 +90,11 @@ func BuildGRPCPayload(md metadata.MD, method string) *GRPCPayload {
 	}
 }
 
+// SignedHeaders returns the sorted list of the headers covered by the payload.
+func (p *GRPCPayload) SignedHeaders() []string {
+	return slices.Sorted(maps.Keys(p.Headers))
+}
+
 // JSON returns the original JSON representation of the payload.
 //
 // This method is only valid after ParseGRPCPayload.
@@ -75,3 +105,22 @@ func (p *GRPCPayload) JSON() ([]byte, error) {
 
 	return p.originalJSON, nil
 }
+
+// RequestDigest returns the hex-encoded SHA-256 digest of the deterministically marshaled request message.
+//
+// The digest only matches the one of the signer if both sides use the same protobuf schema, see RequestDataDigest.
+func RequestDigest(request proto.Message) (string, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	return RequestDataDigest(data), nil
+}
+
+// RequestDataDigest returns the hex-encoded SHA-256 digest of the wire encoding of the request message.
+func RequestDataDigest(data []byte) string {
+	digest := sha256.Sum256(data)
+
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,103 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const nonceSize = 16
+
+// ReplayStore records the seen signatures to protect against replay attacks.
+type ReplayStore interface {
+	// Record records the key as seen until the given expiration time.
+	//
+	// It returns false if the key was already recorded and has not expired yet at the given current time.
+	// The current time comes from the clock of the verifier (see WithClock), and it should be used for the expiration
+	// instead of the system time, as the expiration time is derived from the message timestamp checked by that clock.
+	Record(key string, now, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayStore is an in-memory ReplayStore.
+//
+// Expired keys are removed periodically on Record.
+type MemoryReplayStore struct {
+	seen        map[string]time.Time
+	lastCleanup time.Time
+	lock        sync.Mutex
+}
+
+// NewMemoryReplayStore creates a new in-memory replay store.
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{
+		seen: map[string]time.Time{},
+	}
+}
+
+// Record implements ReplayStore.
+func (s *MemoryReplayStore) Record(key string, now, expiresAt time.Time) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.lastCleanup).Abs() > time.Minute {
+		for k, exp := range s.seen {
+			if now.After(exp) {
+				delete(s.seen, k)
+			}
+		}
+
+		s.lastCleanup = now
+	}
+
+	if exp, ok := s.seen[key]; ok && !now.After(exp) {
+		return false, nil
+	}
+
+	s.seen[key] = expiresAt
+
+	return true, nil
+}
+
+func generateNonce() (string, error) {
+	nonce := make([]byte, nonceSize)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// checkReplay records the signature in the replay store and returns ErrReplayedSignature if it was already seen.
+//
+// The nonce is used as the replay key if present, otherwise the signature itself is used.
+func checkReplay(opts *Options, signature *Signature, nonce string, timestamp *time.Time) error {
+	if opts.ReplayStore == nil {
+		return nil
+	}
+
+	key := signature.KeyFingerprint + " " + nonce
+	if nonce == "" {
+		key = signature.KeyFingerprint + " " + base64.StdEncoding.EncodeToString(signature.Signature)
+	}
+
+	fresh, err := opts.ReplayStore.Record(key, opts.now(), timestamp.Add(opts.allowedClockSkew()))
+	if err != nil {
+		return err
+	}
+
+	if !fresh {
+		return &VerificationError{
+			Reason: ReasonReplayedSignature,
+			Err:    ErrReplayedSignature,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+func TestMemoryReplayStore(t *testing.T) {
+	t.Parallel()
+
+	store := message.NewMemoryReplayStore()
+	now := time.Now()
+
+	fresh, err := store.Record("foo", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = store.Record("foo", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	fresh, err = store.Record("bar", now, now.Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	// expired keys can be recorded again
+	fresh, err = store.Record("bar", now, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+}
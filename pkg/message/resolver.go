@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+)
+
+// ErrKeyNotFound is returned by a KeyResolver when there is no key matching the identity and the fingerprint.
+var ErrKeyNotFound = errors.New("key not found")
+
+// KeyResolver resolves the key which signed a message.
+type KeyResolver interface {
+	// Resolve returns the verifier for the key with the given fingerprint which belongs to the given identity.
+	Resolve(ctx context.Context, identity, fingerprint string) (SignatureVerifier, error)
+}
+
+// validatableKey is implemented by pgp.Key.
+type validatableKey interface {
+	Validate(opt ...pgp.ValidationOption) error
+}
+
+// resolveVerifier resolves the key for the signature, and validates it if it is a PGP key.
+func resolveVerifier(ctx context.Context, resolver KeyResolver, signature *Signature, opts *Options) (SignatureVerifier, error) {
+	if resolver == nil {
+		return nil, errors.New("no key resolver configured")
+	}
+
+	verifier, err := resolver.Resolve(ctx, signature.Identity, signature.KeyFingerprint)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, verificationErrorf(ReasonUnknownKey, "", "%w", err)
+		}
+
+		return nil, err
+	}
+
+	if key, ok := verifier.(validatableKey); ok {
+		if err = key.Validate(opts.KeyValidationOptions...); err != nil {
+			return nil, verificationErrorf(ReasonInvalidKey, "", "invalid key %s: %w", signature.KeyFingerprint, err)
+		}
+	}
+
+	return verifier, nil
+}
+
+// MemoryKeyResolver is an in-memory KeyResolver.
+type MemoryKeyResolver struct {
+	keys map[string]memoryKey
+	lock sync.Mutex
+}
+
+type memoryKey struct {
+	verifier SignatureVerifier
+	identity string
+}
+
+// NewMemoryKeyResolver creates a new empty in-memory key resolver.
+func NewMemoryKeyResolver() *MemoryKeyResolver {
+	return &MemoryKeyResolver{
+		keys: map[string]memoryKey{},
+	}
+}
+
+// Add adds the key with the given fingerprint for the identity.
+func (r *MemoryKeyResolver) Add(identity, fingerprint string, verifier SignatureVerifier) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.keys[fingerprint] = memoryKey{
+		verifier: verifier,
+		identity: identity,
+	}
+}
+
+// Remove removes the key with the given fingerprint.
+func (r *MemoryKeyResolver) Remove(fingerprint string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.keys, fingerprint)
+}
+
+// Resolve implements KeyResolver.
+func (r *MemoryKeyResolver) Resolve(_ context.Context, identity, fingerprint string) (SignatureVerifier, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key, ok := r.keys[fingerprint]
+	if !ok || key.identity != identity {
+		return nil, fmt.Errorf("%w: %s %s", ErrKeyNotFound, identity, fingerprint)
+	}
+
+	return key.verifier, nil
+}
+
+// DirectoryKeyExtensions are the extensions of the key files loaded by the DirectoryKeyResolver.
+var DirectoryKeyExtensions = []string{".asc", ".pgp", ".gpg"}
+
+// DirectoryKeyResolver is a KeyResolver which loads the armored PGP public keys from a directory.
+//
+// The identity of each key is the email address of its primary identity.
+type DirectoryKeyResolver struct {
+	resolver atomic.Pointer[MemoryKeyResolver]
+	dir      string
+}
+
+// NewDirectoryKeyResolver creates a new key resolver and loads the keys from the directory.
+func NewDirectoryKeyResolver(dir string) (*DirectoryKeyResolver, error) {
+	r := &DirectoryKeyResolver{
+		dir: dir,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reloads the keys from the directory.
+//
+// All files in the directory with one of DirectoryKeyExtensions are expected to be armored PGP keys,
+// other files are ignored. Symlinks are followed, e.g. for the Kubernetes Secret and ConfigMap volumes.
+func (r *DirectoryKeyResolver) Reload() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	resolver := NewMemoryKeyResolver()
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !slices.Contains(DirectoryKeyExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+
+		path := filepath.Join(r.dir, entry.Name())
+
+		// follow the symlinks
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key %q: %w", entry.Name(), err)
+		}
+
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		key, err := readArmoredKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key %q: %w", entry.Name(), err)
+		}
+
+		resolver.Add(key.Email(), key.Fingerprint(), key)
+	}
+
+	r.resolver.Store(resolver)
+
+	return nil
+}
+
+// Resolve implements KeyResolver.
+func (r *DirectoryKeyResolver) Resolve(ctx context.Context, identity, fingerprint string) (SignatureVerifier, error) {
+	return r.resolver.Load().Resolve(ctx, identity, fingerprint)
+}
+
+func readArmoredKey(path string) (*pgp.Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	key, err := pgpcrypto.NewKeyFromArmoredReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgp.NewKey(key)
+}
@@ -0,0 +1,161 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+)
+
+const resolverIdentity = "test@example.com"
+
+func TestMemoryKeyResolver(t *testing.T) {
+	t.Parallel()
+
+	key, err := pgp.GenerateKey("test", "test", resolverIdentity, time.Hour)
+	require.NoError(t, err)
+
+	resolver := message.NewMemoryKeyResolver()
+	resolver.Add(resolverIdentity, key.Fingerprint(), key)
+
+	verifier, err := resolver.Resolve(t.Context(), resolverIdentity, key.Fingerprint())
+	require.NoError(t, err)
+
+	assert.Same(t, key, verifier)
+
+	_, err = resolver.Resolve(t.Context(), "other@example.com", key.Fingerprint())
+	require.ErrorIs(t, err, message.ErrKeyNotFound)
+
+	resolver.Remove(key.Fingerprint())
+
+	_, err = resolver.Resolve(t.Context(), resolverIdentity, key.Fingerprint())
+	require.ErrorIs(t, err, message.ErrKeyNotFound)
+}
+
+func TestDirectoryKeyResolver(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	key, err := pgp.GenerateKey("test", "test", resolverIdentity, time.Hour)
+	require.NoError(t, err)
+
+	armored, err := key.ArmorPublic()
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.asc"), []byte(armored), 0o600))
+
+	// files which are not keys are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("keys"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitkeep"), nil, 0o600))
+
+	resolver, err := message.NewDirectoryKeyResolver(dir)
+	require.NoError(t, err)
+
+	verifier, err := resolver.Resolve(t.Context(), resolverIdentity, key.Fingerprint())
+	require.NoError(t, err)
+
+	signature, err := key.Sign([]byte("data"))
+	require.NoError(t, err)
+
+	assert.NoError(t, verifier.Verify([]byte("data"), signature))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "test.asc")))
+	require.NoError(t, resolver.Reload())
+
+	_, err = resolver.Resolve(t.Context(), resolverIdentity, key.Fingerprint())
+	require.ErrorIs(t, err, message.ErrKeyNotFound)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "garbage.asc"), []byte("garbage"), 0o600))
+	require.Error(t, resolver.Reload())
+}
+
+func TestDirectoryKeyResolverSymlinks(t *testing.T) {
+	t.Parallel()
+
+	// the layout of the Kubernetes Secret and ConfigMap volumes
+	dir := t.TempDir()
+
+	key, err := pgp.GenerateKey("test", "test", resolverIdentity, time.Hour)
+	require.NoError(t, err)
+
+	armored, err := key.ArmorPublic()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2024_01_01_00_00_00.000000000"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "..2024_01_01_00_00_00.000000000", "test.asc"), []byte(armored), 0o600))
+	require.NoError(t, os.Symlink("..2024_01_01_00_00_00.000000000", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "test.asc"), filepath.Join(dir, "test.asc")))
+
+	resolver, err := message.NewDirectoryKeyResolver(dir)
+	require.NoError(t, err)
+
+	_, err = resolver.Resolve(t.Context(), resolverIdentity, key.Fingerprint())
+	require.NoError(t, err)
+}
+
+func TestVerifyWith(t *testing.T) {
+	t.Parallel()
+
+	validKey, err := pgp.GenerateKey("test", "test", resolverIdentity, time.Hour)
+	require.NoError(t, err)
+
+	longLivedKey, err := pgp.GenerateKey("test", "test", resolverIdentity, 24*time.Hour)
+	require.NoError(t, err)
+
+	resolver := message.NewMemoryKeyResolver()
+	resolver.Add(resolverIdentity, validKey.Fingerprint(), validKey)
+	resolver.Add(resolverIdentity, longLivedKey.Fingerprint(), longLivedKey)
+
+	sign := func(t *testing.T, key *pgp.Key) metadata.MD {
+		m := message.NewGRPC(metadata.Pairs(), "some.method.Name")
+
+		require.NoError(t, m.Sign(resolverIdentity, key))
+
+		return m.Metadata
+	}
+
+	t.Run("valid key", func(t *testing.T) {
+		t.Parallel()
+
+		signature, err := message.NewGRPC(sign(t, validKey), "some.method.Name").VerifyWith(t.Context(), resolver)
+		require.NoError(t, err)
+
+		assert.Equal(t, resolverIdentity, signature.Identity)
+		assert.Equal(t, validKey.Fingerprint(), signature.KeyFingerprint)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		t.Parallel()
+
+		unknownKey, err := pgp.GenerateKey("test", "test", resolverIdentity, time.Hour)
+		require.NoError(t, err)
+
+		_, err = message.NewGRPC(sign(t, unknownKey), "some.method.Name").VerifyWith(t.Context(), resolver)
+		require.ErrorIs(t, err, message.ErrKeyNotFound)
+	})
+
+	t.Run("key validation", func(t *testing.T) {
+		t.Parallel()
+
+		md := sign(t, longLivedKey)
+
+		_, err := message.NewGRPC(md, "some.method.Name").VerifyWith(t.Context(), resolver)
+		require.ErrorContains(t, err, "key lifetime is too long")
+
+		_, err = message.NewGRPC(md, "some.method.Name", message.WithKeyValidationOptions(pgp.WithMaxAllowedLifetime(48*time.Hour))).
+			VerifyWith(t.Context(), resolver)
+		require.NoError(t, err)
+	})
+}
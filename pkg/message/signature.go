@@ -4,11 +4,27 @@
 
 package message
 
+import (
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
 // SignatureVersion represents the version of the signature in GRPC metadata.
 type SignatureVersion string
 
-// SignatureVersionV1 is the signature version v1.
-const SignatureVersionV1 SignatureVersion = "siderov1"
+// Supported signature versions.
+const (
+	// SignatureVersionV1 is the signature version v1.
+	SignatureVersionV1 SignatureVersion = "siderov1"
+
+	// SignatureVersionV2 is the signature version v2.
+	//
+	// In addition to v1, the GRPC payload contains the digest of the request message.
+	SignatureVersionV2 SignatureVersion = "siderov2"
+)
 
 // Signer is a signer of a GRPC request, e.g. a PGP private key.
 type Signer interface {
@@ -21,9 +37,171 @@ type SignatureVerifier interface {
 	Verify(data, signature []byte) error
 }
 
-// Signature represents a GRPC signature version 1.
+// Signature represents a GRPC signature.
 type Signature struct {
+	// Params are the extension parameters of the signature header.
+	//
+	// Params are not covered by the signature, and the signature header with params can't be parsed by the older verifiers.
+	Params map[string]string
+
+	Version        SignatureVersion
 	Identity       string
 	KeyFingerprint string
 	Signature      []byte
 }
+
+// ParseSignatureHeader parses the value of the signature header.
+//
+// The signature header has the following format:
+//
+//	signature-header = version SP identity SP fingerprint SP signature *( SP param )
+//	version          = "siderov1" / "siderov2"
+//	identity         = 1*VCHAR ; printable ASCII characters, no spaces
+//	fingerprint      = 1*VCHAR
+//	signature        = 1*base64-char ; standard base64 encoding with padding
+//	param            = param-key "=" param-value
+//	param-key        = 1*( %x61-7A / DIGIT / "-" / "_" / "." ) ; lowercase
+//	param-value      = 1*VCHAR
+//
+// ErrNotFound is returned if the value is empty, and VerificationError is returned if the value is malformed.
+func ParseSignatureHeader(value string) (*Signature, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, SignatureHeaderKey)
+	}
+
+	malformed := func(format string, args ...any) error {
+		return verificationErrorf(ReasonMalformedHeader, SignatureHeaderKey, "invalid signature header: "+format, args...)
+	}
+
+	fields := strings.Split(value, " ")
+	if len(fields) < 4 {
+		return nil, malformed("expected at least 4 fields, got %d", len(fields))
+	}
+
+	for i, field := range fields {
+		if err := validateHeaderToken(field); err != nil {
+			return nil, malformed("field %d: %w", i+1, err)
+		}
+	}
+
+	version := SignatureVersion(fields[0])
+	if version != SignatureVersionV1 && version != SignatureVersionV2 {
+		return nil, verificationErrorf(ReasonUnsupportedVersion, SignatureHeaderKey, "unsupported signature version: %s", fields[0])
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return nil, malformed("%w", err)
+	}
+
+	if len(signature) == 0 {
+		return nil, malformed("empty signature")
+	}
+
+	var params map[string]string
+
+	for _, field := range fields[4:] {
+		key, paramValue, ok := strings.Cut(field, "=")
+		if !ok || paramValue == "" {
+			return nil, malformed("invalid parameter: %q", field)
+		}
+
+		if err = validateParamKey(key); err != nil {
+			return nil, malformed("%w", err)
+		}
+
+		if params == nil {
+			params = map[string]string{}
+		}
+
+		if _, ok = params[key]; ok {
+			return nil, malformed("duplicate parameter: %q", key)
+		}
+
+		params[key] = paramValue
+	}
+
+	return &Signature{
+		Version:        version,
+		Identity:       fields[1],
+		KeyFingerprint: fields[2],
+		Signature:      signature,
+		Params:         params,
+	}, nil
+}
+
+// FormatSignatureHeader returns the value of the signature header for the signature, see ParseSignatureHeader for the format.
+//
+// SignatureVersionV1 is used if the version is not set.
+// Identities and fingerprints which can't be represented in the header (e.g. containing spaces) are rejected.
+func FormatSignatureHeader(signature *Signature) (string, error) {
+	version := signature.Version
+	if version == "" {
+		version = SignatureVersionV1
+	}
+
+	if version != SignatureVersionV1 && version != SignatureVersionV2 {
+		return "", fmt.Errorf("unsupported signature version: %s", version)
+	}
+
+	if err := validateHeaderToken(signature.Identity); err != nil {
+		return "", fmt.Errorf("invalid identity %q: %w", signature.Identity, err)
+	}
+
+	if err := validateHeaderToken(signature.KeyFingerprint); err != nil {
+		return "", fmt.Errorf("invalid fingerprint %q: %w", signature.KeyFingerprint, err)
+	}
+
+	if len(signature.Signature) == 0 {
+		return "", fmt.Errorf("empty signature")
+	}
+
+	fields := []string{string(version), signature.Identity, signature.KeyFingerprint, base64.StdEncoding.EncodeToString(signature.Signature)}
+
+	for _, key := range slices.Sorted(maps.Keys(signature.Params)) {
+		paramValue := signature.Params[key]
+
+		if err := validateParamKey(key); err != nil {
+			return "", err
+		}
+
+		if err := validateHeaderToken(paramValue); err != nil {
+			return "", fmt.Errorf("invalid parameter %q value: %w", key, err)
+		}
+
+		fields = append(fields, key+"="+paramValue)
+	}
+
+	return strings.Join(fields, " "), nil
+}
+
+// validateHeaderToken checks that the value is not empty and consists of the printable ASCII characters without spaces.
+func validateHeaderToken(value string) error {
+	if value == "" {
+		return fmt.Errorf("empty value")
+	}
+
+	for i := range len(value) {
+		if c := value[i]; c <= 0x20 || c >= 0x7f {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+
+	return nil
+}
+
+func validateParamKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("empty parameter key")
+	}
+
+	for i := range len(key) {
+		c := key[i]
+
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' && c != '.' {
+			return fmt.Errorf("invalid character %q in parameter key %q", c, key)
+		}
+	}
+
+	return nil
+}
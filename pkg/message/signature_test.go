@@ -0,0 +1,177 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+func TestParseSignatureHeader(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		expected       *message.Signature
+		expectedErr    error
+		name           string
+		value          string
+		expectedReason message.VerificationReason
+	}{
+		{
+			name:  "v1",
+			value: "siderov1 test@example.com ABCDEF Zm9v",
+			expected: &message.Signature{
+				Version:        message.SignatureVersionV1,
+				Identity:       "test@example.com",
+				KeyFingerprint: "ABCDEF",
+				Signature:      []byte("foo"),
+			},
+		},
+		{
+			name:  "v2 with params",
+			value: "siderov2 test@example.com ABCDEF Zm9v alg=pgp key-id.x=1",
+			expected: &message.Signature{
+				Version:        message.SignatureVersionV2,
+				Identity:       "test@example.com",
+				KeyFingerprint: "ABCDEF",
+				Signature:      []byte("foo"),
+				Params:         map[string]string{"alg": "pgp", "key-id.x": "1"},
+			},
+		},
+		{
+			name:        "empty",
+			value:       "",
+			expectedErr: message.ErrNotFound,
+		},
+		{
+			name:           "too few fields",
+			value:          "siderov1 foo",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "double space",
+			value:          "siderov1  test@example.com ABCDEF Zm9v",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "control character",
+			value:          "siderov1 test\x00@example.com ABCDEF Zm9v",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "invalid base64",
+			value:          "siderov1 test@example.com ABCDEF Zm9v!",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "invalid param",
+			value:          "siderov1 test@example.com ABCDEF Zm9v foo",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "invalid param key",
+			value:          "siderov1 test@example.com ABCDEF Zm9v Foo=bar",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "duplicate param",
+			value:          "siderov1 test@example.com ABCDEF Zm9v foo=bar foo=baz",
+			expectedReason: message.ReasonMalformedHeader,
+		},
+		{
+			name:           "unsupported version",
+			value:          "siderov0 test@example.com ABCDEF Zm9v",
+			expectedReason: message.ReasonUnsupportedVersion,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			signature, err := message.ParseSignatureHeader(tt.value)
+
+			switch {
+			case tt.expectedErr != nil:
+				require.ErrorIs(t, err, tt.expectedErr)
+			case tt.expectedReason != message.ReasonUnknown:
+				require.ErrorIs(t, err, &message.VerificationError{Reason: tt.expectedReason, Header: message.SignatureHeaderKey})
+			default:
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.expected, signature)
+
+				formatted, err := message.FormatSignatureHeader(signature)
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.value, formatted)
+			}
+		})
+	}
+}
+
+func TestFormatSignatureHeader(t *testing.T) {
+	t.Parallel()
+
+	formatted, err := message.FormatSignatureHeader(&message.Signature{
+		Identity:       "test@example.com",
+		KeyFingerprint: "ABCDEF",
+		Signature:      []byte("foo"),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "siderov1 test@example.com ABCDEF Zm9v", formatted)
+
+	for _, signature := range []*message.Signature{
+		{Identity: "test user", KeyFingerprint: "ABCDEF", Signature: []byte("foo")},
+		{Identity: "", KeyFingerprint: "ABCDEF", Signature: []byte("foo")},
+		{Identity: "test@example.com", KeyFingerprint: "ABC DEF", Signature: []byte("foo")},
+		{Identity: "test@example.com", KeyFingerprint: "ABCDEF"},
+		{Identity: "test@example.com", KeyFingerprint: "ABCDEF", Signature: []byte("foo"), Version: "siderov0"},
+		{Identity: "test@example.com", KeyFingerprint: "ABCDEF", Signature: []byte("foo"), Params: map[string]string{"foo": "bar baz"}},
+		{Identity: "test@example.com", KeyFingerprint: "ABCDEF", Signature: []byte("foo"), Params: map[string]string{"a=b": "c"}},
+	} {
+		_, err = message.FormatSignatureHeader(signature)
+		assert.Error(t, err, "signature: %+v", signature)
+	}
+}
+
+func FuzzParseSignatureHeader(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		" ",
+		"siderov1",
+		"siderov1 foo",
+		"siderov1 foo bar",
+		"siderov1 foo bar baz",
+		"siderov1 test@example.com ABCDEF Zm9v",
+		"siderov2 test@example.com ABCDEF Zm9v alg=pgp",
+		"siderov2 test@example.com ABCDEF Zm9v =",
+		"siderov1 test@example.com ABCDEF Zm9v==",
+		"siderov1 test@example.com ABCDEF Zm9w",
+		"siderov1 test@example.com ABCDEF Zm9v\n",
+		"siderov1 тест ABCDEF Zm9v",
+		"siderov1    ",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		signature, err := message.ParseSignatureHeader(value)
+		if err != nil {
+			return
+		}
+
+		formatted, err := message.FormatSignatureHeader(signature)
+		require.NoError(t, err)
+
+		reparsed, err := message.ParseSignatureHeader(formatted)
+		require.NoError(t, err)
+
+		assert.Equal(t, signature, reparsed)
+	})
+}
@@ -0,0 +1,295 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// StreamEnvelopeFieldNumber is the protobuf field number of the signed envelope attached to the stream messages.
+//
+// The envelope is stored in the unknown fields of the message, so it is ignored by the receivers which don't verify the stream messages.
+const StreamEnvelopeFieldNumber = protowire.MaxValidNumber
+
+// StreamEnvelopeHeader is the pseudo-header reported in the VerificationError of the stream message envelope.
+const StreamEnvelopeHeader = "stream-envelope"
+
+// StreamPayload is the payload signed for each message sent on a signed stream.
+//
+// The payload is bound to the stream by the method and the nonce of the signed stream metadata,
+// and the sequence number protects against the reordering and the replay of the messages within the stream.
+type StreamPayload struct {
+	Method      string `json:"method"`
+	StreamNonce string `json:"stream_nonce"`
+
+	// BodyDigest is the hex-encoded SHA-256 digest of the message without the envelope, see RequestDigest.
+	BodyDigest string `json:"body_digest"`
+
+	Sequence  uint64 `json:"sequence"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// StreamEnvelope is the envelope attached to each message sent on a signed stream.
+type StreamEnvelope struct {
+	// Signature is the value of the signature header for the payload, see FormatSignatureHeader.
+	Signature string `json:"signature"`
+
+	// Payload is the JSON representation of the StreamPayload, the signature is verified against it.
+	Payload json.RawMessage `json:"payload"`
+}
+
+// StreamSigner signs the messages sent on a stream.
+//
+// The stream metadata must be signed (see GRPC.Sign) before the signer is created, as the messages are bound to its nonce.
+// StreamSigner is not safe for concurrent use, same as grpc.ClientStream.SendMsg.
+type StreamSigner struct {
+	signer   Signer
+	identity string
+	method   string
+	nonce    string
+	options  Options
+	sequence uint64
+}
+
+// NewStreamSigner creates a new StreamSigner for the stream with the given signed metadata, see GRPC.Sign.
+func NewStreamSigner(m *GRPC, identity string, signer Signer) (*StreamSigner, error) {
+	nonce := m.firstHeader(NonceHeaderKey)
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, NonceHeaderKey)
+	}
+
+	return &StreamSigner{
+		signer:   signer,
+		identity: identity,
+		method:   m.Method,
+		nonce:    nonce,
+		options:  m.Options,
+	}, nil
+}
+
+// Sign returns a copy of the message with the signed envelope attached.
+//
+// The envelope of the message, if present, is replaced.
+func (s *StreamSigner) Sign(msg proto.Message) (proto.Message, error) {
+	signed := proto.Clone(msg)
+
+	removeStreamEnvelope(signed.ProtoReflect())
+
+	bodyDigest, err := RequestDigest(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sequence++
+
+	payloadJSON, err := json.Marshal(StreamPayload{
+		Method:      s.method,
+		StreamNonce: s.nonce,
+		BodyDigest:  bodyDigest,
+		Sequence:    s.sequence,
+		Timestamp:   s.options.now().Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := s.signer.Sign(payloadJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureHeader, err := FormatSignatureHeader(&Signature{
+		Version:        SignatureVersionV2,
+		Identity:       s.identity,
+		KeyFingerprint: s.signer.Fingerprint(),
+		Signature:      signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	envelopeJSON, err := json.Marshal(StreamEnvelope{
+		Signature: signatureHeader,
+		Payload:   payloadJSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := signed.ProtoReflect()
+
+	unknown := m.GetUnknown()
+	unknown = protowire.AppendTag(unknown, StreamEnvelopeFieldNumber, protowire.BytesType)
+	unknown = protowire.AppendBytes(unknown, envelopeJSON)
+
+	m.SetUnknown(unknown)
+
+	return signed, nil
+}
+
+// StreamVerifier verifies the messages received on a signed stream.
+//
+// The messages must be signed by the same key as the stream metadata, in order.
+// StreamVerifier is not safe for concurrent use, same as grpc.ServerStream.RecvMsg.
+type StreamVerifier struct {
+	verifier  SignatureVerifier
+	signature *Signature
+	method    string
+	nonce     string
+	options   Options
+	sequence  uint64
+}
+
+// NewStreamVerifier creates a new StreamVerifier for the stream with the given verified metadata, see GRPC.VerifyWith.
+//
+// The key is resolved for the signature of the stream metadata, and all messages must be signed by that key.
+func NewStreamVerifier(ctx context.Context, m *GRPC, signature *Signature, resolver KeyResolver) (*StreamVerifier, error) {
+	nonce := m.firstHeader(NonceHeaderKey)
+	if nonce == "" {
+		return nil, verificationErrorf(ReasonMalformedHeader, NonceHeaderKey, "%w: %s", ErrNotFound, NonceHeaderKey)
+	}
+
+	verifier, err := resolveVerifier(ctx, resolver, signature, &m.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamVerifier{
+		verifier:  verifier,
+		signature: signature,
+		method:    m.Method,
+		nonce:     nonce,
+		options:   m.Options,
+	}, nil
+}
+
+// Verify verifies the signed envelope of the message and removes it from the message.
+func (v *StreamVerifier) Verify(msg proto.Message) error {
+	m := msg.ProtoReflect()
+
+	envelopeJSON, found := removeStreamEnvelope(m)
+	if !found {
+		return &VerificationError{
+			Reason: ReasonMissingSignature,
+			Header: StreamEnvelopeHeader,
+			Err:    fmt.Errorf("%w: stream message is not signed", ErrInvalidSignature),
+		}
+	}
+
+	var envelope StreamEnvelope
+
+	if err := json.Unmarshal(envelopeJSON, &envelope); err != nil {
+		return verificationErrorf(ReasonMalformedHeader, StreamEnvelopeHeader, "invalid stream envelope: %w", err)
+	}
+
+	signature, err := ParseSignatureHeader(envelope.Signature)
+	if err != nil {
+		return err
+	}
+
+	if signature.Identity != v.signature.Identity || signature.KeyFingerprint != v.signature.KeyFingerprint {
+		return verificationErrorf(ReasonUnknownKey, "", "stream message is signed by a different key: %s %s", signature.Identity, signature.KeyFingerprint)
+	}
+
+	var payload StreamPayload
+
+	if err = json.Unmarshal(envelope.Payload, &payload); err != nil {
+		return verificationErrorf(ReasonMalformedHeader, StreamEnvelopeHeader, "invalid stream payload: %w", err)
+	}
+
+	if err = v.verifyPayload(&payload, msg); err != nil {
+		return err
+	}
+
+	if err = v.verifier.Verify(envelope.Payload, signature.Signature); err != nil {
+		return verificationErrorf(ReasonBadSignature, "", "%w", err)
+	}
+
+	v.sequence = payload.Sequence
+
+	return nil
+}
+
+func (v *StreamVerifier) verifyPayload(payload *StreamPayload, msg proto.Message) error {
+	if payload.Method != v.method {
+		return verificationErrorf(ReasonMethodMismatch, "", "payload method does not match: %s != %s", payload.Method, v.method)
+	}
+
+	if payload.StreamNonce != v.nonce {
+		return verificationErrorf(ReasonHeaderMismatch, NonceHeaderKey, "payload stream nonce does not match")
+	}
+
+	if payload.Sequence != v.sequence+1 {
+		return &VerificationError{
+			Reason: ReasonReplayedSignature,
+			Err:    fmt.Errorf("%w: unexpected stream message sequence %d, expected %d", ErrReplayedSignature, payload.Sequence, v.sequence+1),
+		}
+	}
+
+	timestamp := time.Unix(payload.Timestamp, 0)
+
+	if err := verifyTimestamp(&timestamp, &v.options); err != nil {
+		return err
+	}
+
+	bodyDigest, err := RequestDigest(msg)
+	if err != nil {
+		return err
+	}
+
+	if payload.BodyDigest != bodyDigest {
+		return verificationErrorf(ReasonBodyMismatch, "", "payload body digest does not match")
+	}
+
+	return nil
+}
+
+// removeStreamEnvelope removes the stream envelope from the unknown fields of the message and returns its last value.
+func removeStreamEnvelope(m protoreflect.Message) ([]byte, bool) {
+	unknown := m.GetUnknown()
+	if len(unknown) == 0 {
+		return nil, false
+	}
+
+	var (
+		envelope []byte
+		found    bool
+		rest     protoreflect.RawFields
+	)
+
+	for b := unknown; len(b) > 0; {
+		num, typ, tagLen := protowire.ConsumeTag(b)
+		if tagLen < 0 {
+			return nil, false
+		}
+
+		fieldLen := protowire.ConsumeFieldValue(num, typ, b[tagLen:])
+		if fieldLen < 0 {
+			return nil, false
+		}
+
+		if num == StreamEnvelopeFieldNumber && typ == protowire.BytesType {
+			envelope, _ = protowire.ConsumeBytes(b[tagLen:])
+			found = true
+		} else {
+			rest = append(rest, b[:tagLen+fieldLen]...)
+		}
+
+		b = b[tagLen+fieldLen:]
+	}
+
+	if found {
+		m.SetUnknown(rest)
+	}
+
+	return envelope, found
+}
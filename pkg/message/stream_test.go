@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package message_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+func TestStream(t *testing.T) {
+	const (
+		identity = "test@example.com"
+		method   = "/grpc.testing.TestService/StreamingInputCall"
+	)
+
+	resolver := message.NewMemoryKeyResolver()
+	resolver.Add(identity, mockSignerVerifier{}.Fingerprint(), mockSignerVerifier{})
+
+	newStream := func(t *testing.T) (*message.StreamSigner, *message.StreamVerifier) {
+		clientMsg := message.NewGRPC(metadata.New(nil), method)
+		require.NoError(t, clientMsg.Sign(identity, mockSignerVerifier{}))
+
+		signer, err := message.NewStreamSigner(clientMsg, identity, mockSignerVerifier{})
+		require.NoError(t, err)
+
+		serverMsg := message.NewGRPC(clientMsg.Metadata, method)
+
+		signature, err := serverMsg.VerifyWith(t.Context(), resolver)
+		require.NoError(t, err)
+
+		verifier, err := message.NewStreamVerifier(t.Context(), serverMsg, signature, resolver)
+		require.NoError(t, err)
+
+		return signer, verifier
+	}
+
+	newRequest := func(body string) *grpc_testing.StreamingInputCallRequest {
+		return &grpc_testing.StreamingInputCallRequest{
+			Payload: &grpc_testing.Payload{
+				Body: []byte(body),
+			},
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		signer, verifier := newStream(t)
+
+		for _, body := range []string{"foo", "bar", "foo"} {
+			req := newRequest(body)
+
+			signed, err := signer.Sign(req)
+			require.NoError(t, err)
+
+			assert.Empty(t, req.ProtoReflect().GetUnknown(), "original message should not be modified")
+
+			received := roundtrip(t, signed)
+
+			require.NoError(t, verifier.Verify(received))
+
+			assert.True(t, proto.Equal(req, received))
+		}
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		_, verifier := newStream(t)
+
+		err := verifier.Verify(newRequest("foo"))
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonMissingSignature})
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		signer, verifier := newStream(t)
+
+		signed, err := signer.Sign(newRequest("foo"))
+		require.NoError(t, err)
+
+		received := roundtrip(t, signed)
+		received.(*grpc_testing.StreamingInputCallRequest).Payload.Body = []byte("bar") //nolint:forcetypeassert,errcheck
+
+		err = verifier.Verify(received)
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonBodyMismatch})
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		signer, verifier := newStream(t)
+
+		signed, err := signer.Sign(newRequest("foo"))
+		require.NoError(t, err)
+
+		require.NoError(t, verifier.Verify(roundtrip(t, signed)))
+
+		err = verifier.Verify(roundtrip(t, signed))
+		assert.ErrorIs(t, err, message.ErrReplayedSignature)
+	})
+
+	t.Run("other stream", func(t *testing.T) {
+		signer, _ := newStream(t)
+		_, verifier := newStream(t)
+
+		signed, err := signer.Sign(newRequest("foo"))
+		require.NoError(t, err)
+
+		err = verifier.Verify(roundtrip(t, signed))
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonHeaderMismatch, Header: message.NonceHeaderKey})
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clientMsg := message.NewGRPC(metadata.New(nil), method)
+		require.NoError(t, clientMsg.Sign(identity, mockSignerVerifier{}))
+
+		clientMsg.Options.Clock = func() time.Time { return time.Now().Add(-time.Hour) }
+
+		signer, err := message.NewStreamSigner(clientMsg, identity, mockSignerVerifier{})
+		require.NoError(t, err)
+
+		serverMsg := message.NewGRPC(clientMsg.Metadata, method)
+
+		signature, err := serverMsg.VerifyWith(t.Context(), resolver)
+		require.NoError(t, err)
+
+		verifier, err := message.NewStreamVerifier(t.Context(), serverMsg, signature, resolver)
+		require.NoError(t, err)
+
+		signed, err := signer.Sign(newRequest("foo"))
+		require.NoError(t, err)
+
+		err = verifier.Verify(roundtrip(t, signed))
+		assert.ErrorIs(t, err, &message.VerificationError{Reason: message.ReasonExpiredTimestamp})
+	})
+}
+
+// roundtrip marshals and unmarshals the message, as it is sent over the wire.
+func roundtrip(t *testing.T, msg proto.Message) proto.Message {
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	received := msg.ProtoReflect().New().Interface()
+
+	require.NoError(t, proto.Unmarshal(data, received))
+
+	return received
+}
@@ -0,0 +1,118 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+)
+
+// writeKey writes the armored key with the given fingerprint to the KeyStore and verifies it.
+//
+// If the KeyStore implements KeyBackuper, the backup of the replaced key is removed once the written key is verified,
+// or restored if the verification fails.
+func (provider *KeyProvider) writeKey(context, email string, armored []byte, fingerprint string) (string, error) {
+	location, err := provider.store.Write(context, email, armored)
+	if err != nil {
+		return "", err
+	}
+
+	backuper, hasBackups := provider.store.(KeyBackuper)
+
+	if err = provider.verifyWrittenKey(context, email, fingerprint); err != nil {
+		if hasBackups {
+			if restoreErr := backuper.RestoreBackup(context, email); restoreErr != nil && !errors.Is(restoreErr, fs.ErrNotExist) {
+				return "", fmt.Errorf("failed to restore the key from the backup: %w", errors.Join(err, restoreErr))
+			}
+		}
+
+		return "", fmt.Errorf("failed to verify the written key: %w", err)
+	}
+
+	if hasBackups {
+		if err = backuper.RemoveBackup(context, email); err != nil {
+			return "", err
+		}
+	}
+
+	return location, nil
+}
+
+// verifyWrittenKey reads the key back from the KeyStore, and checks that it is the valid key with the given fingerprint.
+func (provider *KeyProvider) verifyWrittenKey(context, email, fingerprint string) error {
+	armored, err := provider.store.Read(context, email)
+	if err != nil {
+		return err
+	}
+
+	key, err := pgpcrypto.NewKeyFromArmored(string(armored))
+	if err != nil {
+		return err
+	}
+
+	// the private key might be locked, only the public part is validated
+	publicKey, err := key.ToPublic()
+	if err != nil {
+		return err
+	}
+
+	pgpKey, err := pgp.NewKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	if pgpKey.Fingerprint() != fingerprint {
+		return fmt.Errorf("unexpected key fingerprint %s", pgpKey.Fingerprint())
+	}
+
+	return pgpKey.Validate()
+}
+
+// readKey reads the key from the KeyStore.
+//
+// If the key can't be read or parsed, e.g. it is corrupted, it is recovered from the backup if there is one, see KeyBackuper.
+// Otherwise, the stale backup left by an interrupted write is removed.
+func (provider *KeyProvider) readKey(context, email string) (*pgpcrypto.Key, error) {
+	backuper, hasBackups := provider.store.(KeyBackuper)
+
+	armored, err := provider.store.Read(context, email)
+	if err == nil {
+		var key *pgpcrypto.Key
+
+		if key, err = pgpcrypto.NewKeyFromArmored(string(armored)); err == nil {
+			if hasBackups {
+				backuper.RemoveBackup(context, email) //nolint:errcheck
+			}
+
+			return key, nil
+		}
+	}
+
+	if !hasBackups || os.IsNotExist(err) {
+		return nil, err
+	}
+
+	armored, backupErr := backuper.ReadBackup(context, email)
+	if backupErr != nil {
+		return nil, err
+	}
+
+	key, backupErr := pgpcrypto.NewKeyFromArmored(string(armored))
+	if backupErr != nil {
+		return nil, err
+	}
+
+	if backupErr = backuper.RestoreBackup(context, email); backupErr != nil {
+		return nil, errors.Join(err, backupErr)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+// truncatingKeyStore writes the truncated keys.
+type truncatingKeyStore struct {
+	*client.FileKeyStore
+}
+
+func (store truncatingKeyStore) Write(context, identity string, armored []byte) (string, error) {
+	return store.FileKeyStore.Write(context, identity, armored[:len(armored)/2])
+}
+
+func TestKeyBackup(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	dir := t.TempDir()
+	store := client.NewFileKeyStoreWithFallback("keys", dir, "keys", true)
+	provider := client.NewKeyProviderWithStore(store)
+
+	keyPath := filepath.Join(dir, "keys", "testapp-john@example.com.pgp")
+	backupPath := keyPath + ".bak"
+
+	writeKey := func(t *testing.T) *client.Key {
+		key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+		require.NoError(t, err)
+
+		_, err = provider.WriteKey(key)
+		require.NoError(t, err)
+
+		return key
+	}
+
+	assertKey := func(t *testing.T, expected *client.Key) {
+		key, err := provider.ReadValidKey("testapp", "john@example.com")
+		require.NoError(t, err)
+
+		assert.Equal(t, expected.Fingerprint(), key.Fingerprint())
+		assert.NoFileExists(t, backupPath)
+	}
+
+	// the backup is removed once the written key is verified
+	writeKey(t)
+	key := writeKey(t)
+
+	assert.NoFileExists(t, backupPath)
+
+	// the written key fails the verification, the previous key is restored
+	newKey, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	_, err = client.NewKeyProviderWithStore(truncatingKeyStore{store}).WriteKey(newKey)
+	require.ErrorContains(t, err, "failed to verify the written key")
+
+	assert.NoFileExists(t, backupPath)
+
+	assertKey(t, key)
+
+	// the key is corrupted, it is recovered from the backup
+	backup, err := os.ReadFile(keyPath)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(backupPath, backup, 0o600))
+	require.NoError(t, os.WriteFile(keyPath, backup[:len(backup)/2], 0o600))
+
+	assertKey(t, key)
+
+	// the stale backup left by an interrupted write is removed
+	require.NoError(t, os.WriteFile(backupPath, []byte("stale"), 0o600))
+
+	assertKey(t, key)
+}
@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+)
+
+// KeyInfo describes a key stored by the KeyProvider, see KeyProvider.List.
+type KeyInfo struct {
+	KeyStoreEntry
+
+	// Created is the creation time of the key, zero if the key is unreadable.
+	Created time.Time
+
+	// Expiration is the expiration time of the key, zero if the key doesn't expire or is unreadable.
+	Expiration time.Time
+
+	// Err is the reason why the key is not valid (e.g., expired, unreadable), nil for valid keys.
+	Err error
+
+	Fingerprint string
+
+	// invalid is set if the key was read, but it is not valid.
+	invalid bool
+}
+
+// Valid returns true if the key is valid.
+func (info *KeyInfo) Valid() bool {
+	return info.Err == nil
+}
+
+// List returns all keys in the KeyStore, including invalid ones.
+//
+// The passphrase of the locked keys is not requested, only their public part is validated.
+func (provider *KeyProvider) List() ([]KeyInfo, error) {
+	entries, err := provider.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]KeyInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		infos = append(infos, provider.keyInfo(entry))
+	}
+
+	return infos, nil
+}
+
+// Prune removes the invalid keys (e.g., expired, revoked, corrupted) from the KeyStore and returns them.
+//
+// The keys which can't be read from the KeyStore (e.g., due to the permissions or a wrong passphrase) are kept.
+// Each key is re-read under its lock before the removal, so the keys renewed concurrently by another process are kept, see LockKey.
+func (provider *KeyProvider) Prune(ctx context.Context) ([]KeyInfo, error) {
+	infos, err := provider.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pruned []KeyInfo
+		errs   []error
+	)
+
+	for _, info := range infos {
+		if !info.invalid {
+			continue
+		}
+
+		prunedInfo, err := provider.pruneKey(ctx, info.KeyStoreEntry)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if prunedInfo != nil {
+			pruned = append(pruned, *prunedInfo)
+		}
+	}
+
+	return pruned, errors.Join(errs...)
+}
+
+// pruneKey removes the entry if it is still invalid under the key lock.
+//
+// It returns nil if the entry was not removed.
+func (provider *KeyProvider) pruneKey(ctx context.Context, entry KeyStoreEntry) (*KeyInfo, error) {
+	unlock, err := provider.LockKey(ctx, entry.Context, entry.Identity)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock() //nolint:errcheck
+
+	info := provider.keyInfo(entry)
+	if !info.invalid {
+		return nil, nil //nolint:nilnil
+	}
+
+	if err = provider.store.DeleteEntry(entry); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (provider *KeyProvider) keyInfo(entry KeyStoreEntry) KeyInfo {
+	info := KeyInfo{
+		KeyStoreEntry: entry,
+	}
+
+	armored, err := provider.store.ReadEntry(entry)
+	if err != nil {
+		info.Err = err
+
+		return info
+	}
+
+	key, err := pgpcrypto.NewKeyFromArmored(string(armored))
+	if err == nil {
+		key, err = key.ToPublic()
+	}
+
+	if err != nil {
+		info.Err = err
+		info.invalid = true
+
+		return info
+	}
+
+	pgpKey, err := pgp.NewKey(key)
+	if err != nil {
+		info.Err = err
+		info.invalid = true
+
+		return info
+	}
+
+	info.Fingerprint = pgpKey.Fingerprint()
+	info.Created = pgpKey.CreationTime()
+
+	if expiration, expires := pgpKey.Expiration(); expires {
+		info.Expiration = expiration
+	}
+
+	if err = pgpKey.Validate(); err != nil {
+		info.Err = err
+		info.invalid = true
+	}
+
+	return info
+}
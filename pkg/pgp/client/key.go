@@ -9,7 +9,7 @@ import (
 )
 
 // Key represents an OpenPGP client key pair associated with a context and an identity.
-// It is stored on the filesystem.
+// It is stored in the KeyStore of the KeyProvider.
 type Key struct {
 	*pgp.Key
 	context  string
@@ -0,0 +1,120 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const keyFileExtension = ".pgp"
+
+// ErrInvalidKeyName is returned for the contexts and identities which can't be used in the key names, e.g. path traversal attempts.
+var ErrInvalidKeyName = errors.New("invalid key name")
+
+// keyFileName returns the file name of the key for the given context and identity.
+//
+// The name is "<context>-<identity>.pgp" with "-", path separators and other unsafe characters
+// in the context and the identity percent-encoded, so the name is unambiguous and path-safe.
+// E.g. "a-b" and "c" are stored as "a%2Db-c.pgp", while "a" and "b-c" are stored as "a-b%2Dc.pgp".
+func keyFileName(context, identity string) (string, error) {
+	for _, component := range []string{context, identity} {
+		if err := validateKeyNameComponent(component); err != nil {
+			return "", err
+		}
+	}
+
+	return encodeKeyName(context, identity) + keyFileExtension, nil
+}
+
+// legacyKeyFileName returns the unescaped key file name written by the previous versions, see keyFileName.
+//
+// The context and the identity must be validated with keyFileName first.
+func legacyKeyFileName(context, identity string) string {
+	return context + "-" + identity + keyFileExtension
+}
+
+func validateKeyNameComponent(component string) error {
+	switch {
+	case component == "":
+		return fmt.Errorf("%w: empty context or identity", ErrInvalidKeyName)
+	case component == "." || component == "..":
+		return fmt.Errorf("%w: %q", ErrInvalidKeyName, component)
+	case strings.ContainsAny(component, `/\`):
+		return fmt.Errorf("%w: %q contains a path separator", ErrInvalidKeyName, component)
+	}
+
+	return nil
+}
+
+func encodeKeyName(context, identity string) string {
+	return escapeKeyNameComponent(context) + "-" + escapeKeyNameComponent(identity)
+}
+
+func isSafeKeyNameChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '@' || c == '.' || c == '_' || c == '+'
+}
+
+func escapeKeyNameComponent(component string) string {
+	var sb strings.Builder
+
+	for i := range len(component) {
+		c := component[i]
+
+		if isSafeKeyNameChar(c) {
+			sb.WriteByte(c)
+
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+
+	return sb.String()
+}
+
+// unescapeKeyNameComponent reverses escapeKeyNameComponent, it fails if the component is not escaped canonically.
+func unescapeKeyNameComponent(escaped string) (string, bool) {
+	component, err := url.PathUnescape(escaped)
+	if err != nil || escapeKeyNameComponent(component) != escaped {
+		return "", false
+	}
+
+	return component, true
+}
+
+// parseKeyFileName parses the context and the identity from the key file name, see keyFileName.
+//
+// The legacy unescaped names are split at the last "-" before the "@" of the identity.
+func parseKeyFileName(name string) (context, identity string, ok bool) {
+	name, ok = strings.CutSuffix(name, keyFileExtension)
+	if !ok {
+		return "", "", false
+	}
+
+	if escapedContext, escapedIdentity, found := strings.Cut(name, "-"); found {
+		context, contextOK := unescapeKeyNameComponent(escapedContext)
+		identity, identityOK := unescapeKeyNameComponent(escapedIdentity)
+
+		if contextOK && identityOK && validateKeyNameComponent(context) == nil && validateKeyNameComponent(identity) == nil {
+			return context, identity, true
+		}
+	}
+
+	localPartEnd := strings.LastIndex(name, "@")
+	if localPartEnd < 0 {
+		localPartEnd = len(name)
+	}
+
+	separator := strings.LastIndex(name[:localPartEnd], "-")
+	if separator <= 0 || separator == len(name)-1 {
+		return "", "", false
+	}
+
+	return name[:separator], name[separator+1:], true
+}
@@ -0,0 +1,132 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestKeyFileNames(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	dir := t.TempDir()
+	keysDir := filepath.Join(dir, "keys")
+	store := client.NewFileKeyStoreWithFallback("keys", dir, "keys", true)
+
+	t.Run("hostile", func(t *testing.T) {
+		for _, test := range []struct {
+			context  string
+			identity string
+		}{
+			{context: "../../etc", identity: "john@example.com"},
+			{context: "testapp", identity: "../john@example.com"},
+			{context: "..", identity: "john@example.com"},
+			{context: "testapp", identity: "."},
+			{context: `..\..\windows`, identity: "john@example.com"},
+			{context: "/etc/passwd", identity: "john@example.com"},
+			{context: "", identity: "john@example.com"},
+			{context: "testapp", identity: ""},
+		} {
+			_, err := store.Write(test.context, test.identity, []byte("key"))
+			assert.ErrorIs(t, err, client.ErrInvalidKeyName, "%q %q", test.context, test.identity)
+
+			_, err = store.Read(test.context, test.identity)
+			assert.ErrorIs(t, err, client.ErrInvalidKeyName, "%q %q", test.context, test.identity)
+
+			err = store.Delete(test.context, test.identity)
+			assert.ErrorIs(t, err, client.ErrInvalidKeyName, "%q %q", test.context, test.identity)
+		}
+
+		files, err := os.ReadDir(keysDir)
+		if !os.IsNotExist(err) {
+			require.NoError(t, err)
+			assert.Empty(t, files)
+		}
+	})
+
+	t.Run("unambiguous", func(t *testing.T) {
+		for _, test := range []struct {
+			context      string
+			identity     string
+			expectedName string
+		}{
+			{context: "a-b", identity: "c", expectedName: "a%2Db-c.pgp"},
+			{context: "a", identity: "b-c", expectedName: "a-b%2Dc.pgp"},
+			{context: "default", identity: "john@example.com", expectedName: "default-john@example.com.pgp"},
+			{context: "my context:1", identity: "john%doe@example.com", expectedName: "my%20context%3A1-john%25doe@example.com.pgp"},
+		} {
+			path, err := store.Write(test.context, test.identity, []byte(test.context+"/"+test.identity))
+			require.NoError(t, err)
+
+			assert.Equal(t, filepath.Join(keysDir, test.expectedName), path)
+		}
+
+		for _, test := range []struct {
+			context  string
+			identity string
+		}{
+			{context: "a-b", identity: "c"},
+			{context: "a", identity: "b-c"},
+			{context: "my context:1", identity: "john%doe@example.com"},
+		} {
+			data, err := store.Read(test.context, test.identity)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.context+"/"+test.identity, string(data))
+		}
+
+		entries, err := store.List()
+		require.NoError(t, err)
+
+		var listed []client.KeyStoreEntry
+
+		for _, entry := range entries {
+			entry.Location = filepath.Base(entry.Location)
+
+			listed = append(listed, entry)
+		}
+
+		assert.ElementsMatch(t, []client.KeyStoreEntry{
+			{Context: "a-b", Identity: "c", Location: "a%2Db-c.pgp"},
+			{Context: "a", Identity: "b-c", Location: "a-b%2Dc.pgp"},
+			{Context: "default", Identity: "john@example.com", Location: "default-john@example.com.pgp"},
+			{Context: "my context:1", Identity: "john%doe@example.com", Location: "my%20context%3A1-john%25doe@example.com.pgp"},
+		}, listed)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		legacyPath := filepath.Join(keysDir, "my-app-jane@example.com.pgp")
+
+		require.NoError(t, os.WriteFile(legacyPath, []byte("legacy"), 0o600))
+
+		data, err := store.Read("my-app", "jane@example.com")
+		require.NoError(t, err)
+
+		assert.Equal(t, "legacy", string(data))
+
+		path, err := store.Write("my-app", "jane@example.com", []byte("new"))
+		require.NoError(t, err)
+
+		assert.Equal(t, filepath.Join(keysDir, "my%2Dapp-jane@example.com.pgp"), path)
+		assert.NoFileExists(t, legacyPath)
+
+		data, err = store.Read("my-app", "jane@example.com")
+		require.NoError(t, err)
+
+		assert.Equal(t, "new", string(data))
+	})
+}
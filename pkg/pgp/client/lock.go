@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// lockPollInterval is the interval of the attempts to acquire a key lock held by another process.
+const lockPollInterval = 100 * time.Millisecond
+
+// LockKey acquires the advisory cross-process lock of the key for the given context and identity.
+//
+// It blocks until the lock is acquired or ctx is canceled. The returned function releases the lock.
+// The lock is only advisory: it is respected by the processes which lock the key, e.g. with RenewKey.
+//
+// If the KeyStore doesn't implement KeyLocker, the lock is a no-op.
+func (provider *KeyProvider) LockKey(ctx context.Context, contextName, email string) (func() error, error) {
+	return lockKey(ctx, provider.store, contextName, email)
+}
+
+func lockKey(ctx context.Context, store KeyStore, contextName, identity string) (func() error, error) {
+	locker, ok := store.(KeyLocker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	return locker.Lock(ctx, contextName, identity)
+}
+
+// Lock implements KeyLocker.
+//
+// The lock is held on the "<key file>.lock" file next to the key file.
+func (store *FileKeyStore) Lock(ctx context.Context, contextName, identity string) (func() error, error) {
+	keyPath, err := store.getKeyFilePath(contextName, identity, WRITE)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(keyPath+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close() //nolint:errcheck
+
+			return nil, err
+		}
+
+		if locked {
+			return func() error {
+				unlockErr := unlockFile(f)
+
+				if closeErr := f.Close(); unlockErr == nil {
+					unlockErr = closeErr
+				}
+
+				return unlockErr
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close() //nolint:errcheck
+
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenewKey runs the renew function under the key lock, see LockKey.
+//
+// staleFingerprint is the fingerprint of the key which has to be replaced, e.g. the key rejected by the server,
+// or empty if there is no such key.
+// If a valid key with another fingerprint is read under the lock, the key was renewed by another process,
+// so the renew function is not called, and the key written by the other process is returned instead.
+func (provider *KeyProvider) RenewKey(ctx context.Context, contextName, email, staleFingerprint string, renew func() (*Key, error)) (*Key, error) {
+	// the automatic migration takes the key lock, so it is done before the lock is acquired
+	provider.autoMigrateKey(contextName, email)
+
+	unlock, err := provider.LockKey(ctx, contextName, email)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock() //nolint:errcheck
+
+	if key, err := provider.readValidKey(contextName, email); err == nil && key.Fingerprint() != staleFingerprint {
+		return key, nil
+	}
+
+	return renew()
+}
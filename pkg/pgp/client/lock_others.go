@@ -0,0 +1,18 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !windows && !unix
+
+package client
+
+import "os"
+
+func tryLockFile(*os.File) (bool, error) {
+	// Not implemented for this platform.
+	return true, nil
+}
+
+func unlockFile(*os.File) error {
+	return nil
+}
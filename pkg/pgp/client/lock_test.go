@@ -0,0 +1,287 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build unix
+
+package client_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestLockKey(t *testing.T) {
+	provider := client.NewKeyProviderWithFallback("keys", t.TempDir(), "keys", true)
+
+	unlock, err := provider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 300*time.Millisecond)
+	defer cancel()
+
+	_, err = provider.LockKey(ctx, "testapp", "john@example.com")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// other keys are not affected
+	unlockOther, err := provider.LockKey(t.Context(), "testapp", "jane@example.com")
+	require.NoError(t, err)
+	require.NoError(t, unlockOther())
+
+	require.NoError(t, unlock())
+
+	unlock, err = provider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+	require.NoError(t, unlock())
+}
+
+func TestRenewKey(t *testing.T) {
+	// providers of the different processes sharing the same directory
+	dir := t.TempDir()
+	provider := client.NewKeyProviderWithFallback("keys", dir, "keys", true)
+	otherProvider := client.NewKeyProviderWithFallback("keys", dir, "keys", true)
+
+	renew := renewFunc(provider)
+
+	// no valid key, renew is called
+	key, err := provider.RenewKey(t.Context(), "testapp", "john@example.com", "", renew)
+	require.NoError(t, err)
+
+	// the key is stale, renew is called
+	renewedKey, err := provider.RenewKey(t.Context(), "testapp", "john@example.com", key.Fingerprint(), renew)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key.Fingerprint(), renewedKey.Fingerprint())
+
+	key = renewedKey
+
+	// the other process renews the key while the lock is held
+	unlock, err := otherProvider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+
+	renewedCh := make(chan *client.Key, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		renewed, renewErr := provider.RenewKey(t.Context(), "testapp", "john@example.com", key.Fingerprint(), func() (*client.Key, error) {
+			t.Error("renew should not be called")
+
+			return nil, nil //nolint:nilnil
+		})
+
+		renewedCh <- renewed
+		errCh <- renewErr
+	}()
+
+	// let RenewKey start waiting for the lock
+	time.Sleep(200 * time.Millisecond)
+
+	otherKey, err := renewFunc(otherProvider)()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, key.Fingerprint(), otherKey.Fingerprint())
+
+	require.NoError(t, unlock())
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, otherKey.Fingerprint(), (<-renewedCh).Fingerprint())
+}
+
+func TestRenewKeyAutoMigration(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	customDir := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(xdg.DataHome, "keys"), 0o700))
+
+	xdgProvider := client.NewKeyProviderWithFallback("keys", customDir, "keys", false)
+
+	key, err := renewFunc(xdgProvider)()
+	require.NoError(t, err)
+
+	xdgPath := filepath.Join(xdg.DataHome, "keys", "testapp-john@example.com.pgp")
+	require.FileExists(t, xdgPath)
+
+	provider := client.NewKeyProviderWithFallback("keys", customDir, "keys", true, client.WithAutoMigration())
+
+	// the key is migrated before the lock is acquired, so the migration doesn't wait for the lock held by RenewKey itself
+	renewedKey, err := provider.RenewKey(t.Context(), "testapp", "john@example.com", "", func() (*client.Key, error) {
+		t.Error("renew should not be called")
+
+		return nil, nil //nolint:nilnil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), renewedKey.Fingerprint())
+
+	assert.NoFileExists(t, xdgPath)
+	assert.FileExists(t, filepath.Join(customDir, "keys", "testapp-john@example.com.pgp"))
+}
+
+func TestRenewKeyUnconfirmed(t *testing.T) {
+	// providers of the different processes sharing the same directory
+	dir := t.TempDir()
+	provider := client.NewKeyProviderWithFallback("keys", dir, "keys", true)
+	otherProvider := client.NewKeyProviderWithFallback("keys", dir, "keys", true)
+
+	rejectedKey, err := renewFunc(provider)()
+	require.NoError(t, err)
+
+	// the other process writes the new key before it is confirmed, and confirms it while holding the lock
+	unlock, err := otherProvider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+
+	otherKey, err := renewFunc(otherProvider)()
+	require.NoError(t, err)
+
+	renewedCh := make(chan *client.Key, 1)
+	errCh := make(chan error, 1)
+
+	// the request signed with the rejected key fails after the unconfirmed key is written
+	go func() {
+		renewed, renewErr := provider.RenewKey(t.Context(), "testapp", "john@example.com", rejectedKey.Fingerprint(), func() (*client.Key, error) {
+			t.Error("renew should not be called")
+
+			return nil, nil //nolint:nilnil
+		})
+
+		renewedCh <- renewed
+		errCh <- renewErr
+	}()
+
+	// let RenewKey start waiting for the lock
+	time.Sleep(200 * time.Millisecond)
+
+	require.NoError(t, unlock())
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, otherKey.Fingerprint(), (<-renewedCh).Fingerprint())
+}
+
+// renewFunc returns a renew function which generates and writes a new key, see client.KeyProvider.RenewKey.
+func renewFunc(provider *client.KeyProvider) func() (*client.Key, error) {
+	return func() (*client.Key, error) {
+		key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = provider.WriteKey(key); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+}
+
+func TestPruneLocked(t *testing.T) {
+	dir := t.TempDir()
+	provider := client.NewKeyProviderWithFallback("keys", dir, "keys", true)
+
+	keyPath := filepath.Join(dir, "keys", "testapp-john@example.com.pgp")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(keyPath), 0o700))
+	require.NoError(t, os.WriteFile(keyPath, []byte(armoredKey(t, "john@example.com", time.Now().Add(-2*time.Hour), time.Hour)), 0o600))
+
+	// another process renews the expired key while the lock is held
+	unlock, err := provider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+
+	prunedCh := make(chan []client.KeyInfo, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		pruned, pruneErr := provider.Prune(t.Context())
+
+		prunedCh <- pruned
+		errCh <- pruneErr
+	}()
+
+	// let Prune list the expired key and start waiting for the lock
+	time.Sleep(200 * time.Millisecond)
+
+	key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	_, err = provider.WriteKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, unlock())
+
+	require.NoError(t, <-errCh)
+	assert.Empty(t, <-prunedCh)
+
+	readKey, err := provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), readKey.Fingerprint())
+}
+
+func TestMigrateKeysLocked(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	customDir := t.TempDir()
+	xdgPath := filepath.Join(xdg.DataHome, "keys", "testapp-john@example.com.pgp")
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(xdgPath), 0o700))
+	require.NoError(t, os.WriteFile(xdgPath, []byte(armoredKey(t, "john@example.com", time.Now().Add(-time.Minute), time.Hour)), 0o600))
+
+	provider := client.NewKeyProviderWithFallback("keys", customDir, "keys", true)
+
+	// another process renews the key while the lock is held
+	unlock, err := provider.LockKey(t.Context(), "testapp", "john@example.com")
+	require.NoError(t, err)
+
+	migrationsCh := make(chan []client.KeyMigration, 1)
+	errCh := make(chan error, 1)
+
+	go func() {
+		migrations, migrateErr := provider.MigrateKeys(t.Context())
+
+		migrationsCh <- migrations
+		errCh <- migrateErr
+	}()
+
+	// let MigrateKeys list the key in XDG and start waiting for the lock
+	time.Sleep(200 * time.Millisecond)
+
+	key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	path, err := provider.WriteKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, unlock())
+
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []client.KeyMigration{
+		{
+			Context:  "testapp",
+			Identity: "john@example.com",
+			To:       path,
+			Removed:  []string{xdgPath},
+		},
+	}, <-migrationsCh)
+
+	readKey, err := provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), readKey.Fingerprint())
+}
@@ -0,0 +1,225 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+// autoMigrationLockTimeout is the maximum time to wait for the key lock in the automatic migration mode.
+const autoMigrationLockTimeout = time.Second
+
+// KeyMigration describes the consolidation of a key into its preferred location, see KeyProvider.MigrateKeys.
+type KeyMigration struct {
+	Context  string
+	Identity string
+
+	// From is the location the key was moved from, empty if the key already was in the preferred location.
+	From string
+
+	// To is the preferred location of the key.
+	To string
+
+	// Removed are the locations of the removed stale duplicates of the key.
+	Removed []string
+}
+
+// WithAutoMigration enables the automatic migration of the key to its preferred location on ReadValidKey, see KeyProvider.MigrateKeys.
+//
+// The automatic migration is best-effort: it is skipped if the key is locked by another process, and its errors are ignored.
+func WithAutoMigration() KeyProviderOption {
+	return func(provider *KeyProvider) {
+		provider.autoMigration = true
+	}
+}
+
+// MigrateKeys consolidates each key into its preferred location, e.g. from XDG to the custom directory of the FileKeyStore.
+//
+// If the same key (context and identity) is stored in multiple locations, the most recently created valid one is kept,
+// and the other ones are removed. The keys which have no valid copy are left as is, see Prune.
+// If the KeyStore doesn't implement KeyMigrator, MigrateKeys is a no-op.
+func (provider *KeyProvider) MigrateKeys(ctx context.Context) ([]KeyMigration, error) {
+	if _, ok := provider.store.(KeyMigrator); !ok {
+		return nil, nil
+	}
+
+	infos, err := provider.List()
+	if err != nil {
+		return nil, err
+	}
+
+	type keyID struct {
+		context  string
+		identity string
+	}
+
+	var (
+		ids        []keyID
+		migrations []KeyMigration
+		errs       []error
+	)
+
+	groups := map[keyID][]KeyInfo{}
+
+	for _, info := range infos {
+		id := keyID{context: info.Context, identity: info.Identity}
+
+		if _, ok := groups[id]; !ok {
+			ids = append(ids, id)
+		}
+
+		groups[id] = append(groups[id], info)
+	}
+
+	for _, id := range ids {
+		migration, err := provider.migrateKey(ctx, id.context, id.identity, groups[id])
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if migration != nil {
+			migrations = append(migrations, *migration)
+		}
+	}
+
+	return migrations, errors.Join(errs...)
+}
+
+// autoMigrateKey migrates the key for the given context and identity if the automatic migration is enabled.
+func (provider *KeyProvider) autoMigrateKey(contextName, email string) {
+	if !provider.autoMigration {
+		return
+	}
+
+	if _, ok := provider.store.(KeyMigrator); !ok {
+		return
+	}
+
+	infos, err := provider.listKey(contextName, email)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), autoMigrationLockTimeout)
+	defer cancel()
+
+	provider.migrateKey(ctx, contextName, email, infos) //nolint:errcheck
+}
+
+// migrateKey moves the newest valid copy of the key to the preferred location and removes the other copies.
+//
+// The infos are only used to skip the keys which need no migration without taking the lock:
+// the copies of the key are listed again under the lock, so the keys changed concurrently by another process are not lost.
+// It returns nil if there is nothing to migrate.
+func (provider *KeyProvider) migrateKey(ctx context.Context, contextName, email string, infos []KeyInfo) (*KeyMigration, error) {
+	preferred, err := provider.store.(KeyMigrator).PreferredLocation(contextName, email) //nolint:forcetypeassert,errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	if newestKeyInfo(preferred, infos) == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	unlock, err := provider.LockKey(ctx, contextName, email)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock() //nolint:errcheck
+
+	if infos, err = provider.listKey(contextName, email); err != nil {
+		return nil, err
+	}
+
+	newest := newestKeyInfo(preferred, infos)
+	if newest == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	migration := &KeyMigration{
+		Context:  contextName,
+		Identity: email,
+		To:       preferred,
+	}
+
+	if newest.Location != preferred {
+		armored, err := provider.store.ReadEntry(newest.KeyStoreEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = provider.writeKey(contextName, email, armored, newest.Fingerprint); err != nil {
+			return nil, err
+		}
+
+		migration.From = newest.Location
+	}
+
+	for _, info := range infos {
+		if info.Location == preferred {
+			continue
+		}
+
+		// the legacy key files are already removed by Write
+		if err = provider.store.DeleteEntry(info.KeyStoreEntry); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if info.Location != migration.From {
+			migration.Removed = append(migration.Removed, info.Location)
+		}
+	}
+
+	return migration, nil
+}
+
+// newestKeyInfo returns the most recently created valid copy of the key.
+//
+// It returns nil if there is nothing to migrate: the key has no valid copies, or its only copy is in the preferred location.
+func newestKeyInfo(preferred string, infos []KeyInfo) *KeyInfo {
+	if preferred == "" || len(infos) == 0 || (len(infos) == 1 && infos[0].Location == preferred) {
+		return nil
+	}
+
+	var newest *KeyInfo
+
+	for i := range infos {
+		if !infos[i].Valid() {
+			continue
+		}
+
+		// on the ties, the copy in the preferred location is kept
+		if newest == nil || infos[i].Created.After(newest.Created) ||
+			(infos[i].Created.Equal(newest.Created) && infos[i].Location == preferred) {
+			newest = &infos[i]
+		}
+	}
+
+	return newest
+}
+
+// listKey returns all copies of the key for the given context and identity, see KeyProvider.List.
+func (provider *KeyProvider) listKey(contextName, email string) ([]KeyInfo, error) {
+	entries, err := provider.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []KeyInfo
+
+	for _, entry := range entries {
+		if entry.Context == contextName && entry.Identity == email {
+			infos = append(infos, provider.keyInfo(entry))
+		}
+	}
+
+	return infos, nil
+}
@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	customDir := filepath.Join(t.TempDir(), "keys")
+	xdgDir := filepath.Join(xdg.DataHome, "keys")
+
+	require.NoError(t, os.MkdirAll(xdgDir, 0o700))
+	require.NoError(t, os.MkdirAll(customDir, 0o700))
+
+	writeKey := func(dir, context, identity, armored string) string {
+		path := filepath.Join(dir, context+"-"+identity+".pgp")
+
+		require.NoError(t, os.WriteFile(path, []byte(armored), 0o600))
+
+		return path
+	}
+
+	now := time.Now()
+
+	// only in XDG
+	movedFrom := writeKey(xdgDir, "moved", "john@example.com", armoredKey(t, "john@example.com", now, time.Hour))
+
+	// newer key in XDG
+	newerKey := armoredKey(t, "john@example.com", now, time.Hour)
+	newerFrom := writeKey(xdgDir, "newer", "john@example.com", newerKey)
+	writeKey(customDir, "newer", "john@example.com", armoredKey(t, "john@example.com", now.Add(-time.Minute), time.Hour))
+
+	// newer key in the custom directory, expired one in XDG
+	staleFrom := writeKey(xdgDir, "stale", "john@example.com", armoredKey(t, "john@example.com", now.Add(-2*time.Hour), time.Hour))
+	writeKey(customDir, "stale", "john@example.com", armoredKey(t, "john@example.com", now, time.Hour))
+
+	// newer key in XDG, longer-lived one in the custom directory
+	shorterKey := armoredKey(t, "john@example.com", now, time.Hour)
+	shorterFrom := writeKey(xdgDir, "shorter", "john@example.com", shorterKey)
+	writeKey(customDir, "shorter", "john@example.com", armoredKey(t, "john@example.com", now.Add(-time.Minute), 4*time.Hour))
+
+	// newer key in the custom directory, longer-lived one in XDG
+	longerKey := armoredKey(t, "john@example.com", now, time.Hour)
+	writeKey(customDir, "longer", "john@example.com", longerKey)
+	longerStale := writeKey(xdgDir, "longer", "john@example.com", armoredKey(t, "john@example.com", now.Add(-time.Minute), 4*time.Hour))
+
+	// legacy unescaped names, newer key in XDG
+	legacyKey := armoredKey(t, "john@example.com", now, time.Hour)
+	legacyFrom := writeKey(xdgDir, "my-ctx", "john@example.com", legacyKey)
+	legacyStale := writeKey(customDir, "my-ctx", "john@example.com", armoredKey(t, "john@example.com", now.Add(-time.Minute), time.Hour))
+
+	// no valid keys
+	invalidPath := writeKey(xdgDir, "invalid", "john@example.com", armoredKey(t, "john@example.com", now.Add(-2*time.Hour), time.Hour))
+
+	// already in the preferred location
+	writeKey(customDir, "kept", "john@example.com", armoredKey(t, "john@example.com", now, time.Hour))
+
+	provider := client.NewKeyProviderWithFallback("keys", filepath.Dir(customDir), "keys", true)
+
+	movedKey, err := provider.ReadValidKey("moved", "john@example.com")
+	require.NoError(t, err)
+
+	parsedNewerKey, err := pgpcrypto.NewKeyFromArmored(newerKey)
+	require.NoError(t, err)
+
+	parsedShorterKey, err := pgpcrypto.NewKeyFromArmored(shorterKey)
+	require.NoError(t, err)
+
+	parsedLongerKey, err := pgpcrypto.NewKeyFromArmored(longerKey)
+	require.NoError(t, err)
+
+	parsedLegacyKey, err := pgpcrypto.NewKeyFromArmored(legacyKey)
+	require.NoError(t, err)
+
+	expectedFingerprints := map[string]string{
+		"moved":   movedKey.Fingerprint(),
+		"newer":   parsedNewerKey.GetFingerprint(),
+		"shorter": parsedShorterKey.GetFingerprint(),
+		"longer":  parsedLongerKey.GetFingerprint(),
+		"my-ctx":  parsedLegacyKey.GetFingerprint(),
+	}
+
+	migrations, err := provider.MigrateKeys(t.Context())
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []client.KeyMigration{
+		{
+			Context:  "moved",
+			Identity: "john@example.com",
+			From:     movedFrom,
+			To:       filepath.Join(customDir, "moved-john@example.com.pgp"),
+		},
+		{
+			Context:  "newer",
+			Identity: "john@example.com",
+			From:     newerFrom,
+			To:       filepath.Join(customDir, "newer-john@example.com.pgp"),
+		},
+		{
+			Context:  "shorter",
+			Identity: "john@example.com",
+			From:     shorterFrom,
+			To:       filepath.Join(customDir, "shorter-john@example.com.pgp"),
+		},
+		{
+			Context:  "longer",
+			Identity: "john@example.com",
+			To:       filepath.Join(customDir, "longer-john@example.com.pgp"),
+			Removed:  []string{longerStale},
+		},
+		{
+			Context:  "my-ctx",
+			Identity: "john@example.com",
+			From:     legacyFrom,
+			To:       filepath.Join(customDir, "my%2Dctx-john@example.com.pgp"),
+			Removed:  []string{legacyStale},
+		},
+		{
+			Context:  "stale",
+			Identity: "john@example.com",
+			To:       filepath.Join(customDir, "stale-john@example.com.pgp"),
+			Removed:  []string{staleFrom},
+		},
+	}, migrations)
+
+	assert.NoFileExists(t, movedFrom)
+	assert.NoFileExists(t, newerFrom)
+	assert.NoFileExists(t, staleFrom)
+	assert.NoFileExists(t, shorterFrom)
+	assert.NoFileExists(t, longerStale)
+	assert.NoFileExists(t, legacyFrom)
+	assert.NoFileExists(t, legacyStale)
+	assert.FileExists(t, invalidPath)
+
+	for context, fingerprint := range expectedFingerprints {
+		key, err := provider.ReadValidKey(context, "john@example.com")
+		require.NoError(t, err)
+
+		assert.Equal(t, fingerprint, key.Fingerprint())
+	}
+
+	migrations, err = provider.MigrateKeys(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, migrations)
+}
+
+func TestAutoMigration(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	customDir := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(xdg.DataHome, "keys"), 0o700))
+
+	xdgProvider := client.NewKeyProviderWithFallback("keys", customDir, "keys", false)
+
+	key, err := xdgProvider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	xdgPath, err := xdgProvider.WriteKey(key)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(xdg.DataHome, "keys", "testapp-john@example.com.pgp"), xdgPath)
+
+	provider := client.NewKeyProviderWithFallback("keys", customDir, "keys", true, client.WithAutoMigration())
+
+	readKey, err := provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), readKey.Fingerprint())
+
+	assert.NoFileExists(t, xdgPath)
+	assert.FileExists(t, filepath.Join(customDir, "keys", "testapp-john@example.com.pgp"))
+}
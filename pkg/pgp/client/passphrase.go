@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PassphraseFunc returns the passphrase of the private key for the given context and identity, e.g. by prompting the user.
+//
+// An empty passphrase means that the key is not encrypted.
+type PassphraseFunc func(context, identity string) ([]byte, error)
+
+// PassphraseFromEnv returns a PassphraseFunc which reads the passphrase from the given environment variable.
+//
+// If the variable is not set, the keys are not encrypted.
+func PassphraseFromEnv(name string) PassphraseFunc {
+	return func(string, string) ([]byte, error) {
+		return []byte(os.Getenv(name)), nil
+	}
+}
+
+// PassphraseCache caches the passphrases returned by the PassphraseFunc in memory, similar to gpg-agent.
+//
+// Use PassphraseCache.Passphrase as the PassphraseFunc of the KeyProvider, see WithPassphrase.
+type PassphraseCache struct {
+	source  PassphraseFunc
+	entries map[passphraseCacheKey]passphraseCacheEntry
+	ttl     time.Duration
+	lock    sync.Mutex
+}
+
+type passphraseCacheKey struct {
+	context  string
+	identity string
+}
+
+type passphraseCacheEntry struct {
+	expiresAt  time.Time
+	passphrase []byte
+}
+
+// NewPassphraseCache creates a new PassphraseCache which keeps the passphrases from the source for the given TTL.
+func NewPassphraseCache(source PassphraseFunc, ttl time.Duration) *PassphraseCache {
+	return &PassphraseCache{
+		source:  source,
+		entries: map[passphraseCacheKey]passphraseCacheEntry{},
+		ttl:     ttl,
+	}
+}
+
+// Passphrase implements PassphraseFunc.
+func (cache *PassphraseCache) Passphrase(context, identity string) ([]byte, error) {
+	key := passphraseCacheKey{context: context, identity: identity}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if entry, ok := cache.entries[key]; ok && time.Now().Before(entry.expiresAt) {
+		return slices.Clone(entry.passphrase), nil
+	}
+
+	delete(cache.entries, key)
+
+	passphrase, err := cache.source(context, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.entries[key] = passphraseCacheEntry{
+		expiresAt:  time.Now().Add(cache.ttl),
+		passphrase: slices.Clone(passphrase),
+	}
+
+	return passphrase, nil
+}
+
+// Forget removes the cached passphrase for the given context and identity, e.g. if it turned out to be wrong.
+func (cache *PassphraseCache) Forget(context, identity string) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	delete(cache.entries, passphraseCacheKey{context: context, identity: identity})
+}
@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestPassphrase(t *testing.T) {
+	store := client.NewMemoryKeyStore()
+
+	var (
+		prompts    int
+		passphrase = "secret"
+	)
+
+	cache := client.NewPassphraseCache(func(context, identity string) ([]byte, error) {
+		assert.Equal(t, "testapp", context)
+		assert.Equal(t, "john@example.com", identity)
+
+		prompts++
+
+		return []byte(passphrase), nil
+	}, time.Hour)
+
+	provider := client.NewKeyProviderWithStore(store, client.WithPassphrase(cache.Passphrase))
+
+	key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	_, err = provider.WriteKey(key)
+	require.NoError(t, err)
+
+	armored, err := store.Read("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	storedKey, err := pgpcrypto.NewKeyFromArmored(string(armored))
+	require.NoError(t, err)
+
+	locked, err := storedKey.IsLocked()
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	readKey, err := provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), readKey.Fingerprint())
+	assert.Equal(t, 1, prompts)
+
+	_, err = client.NewKeyProviderWithStore(store).ReadValidKey("testapp", "john@example.com")
+	assert.ErrorContains(t, err, "private key is locked")
+
+	cache.Forget("testapp", "john@example.com")
+
+	passphrase = "wrong"
+
+	_, err = provider.ReadValidKey("testapp", "john@example.com")
+	assert.ErrorContains(t, err, "failed to unlock private key")
+	assert.Equal(t, 2, prompts)
+}
+
+func TestPassphraseFromEnv(t *testing.T) {
+	store := client.NewMemoryKeyStore()
+	provider := client.NewKeyProviderWithStore(store, client.WithPassphrase(client.PassphraseFromEnv("TEST_KEY_PASSPHRASE")))
+
+	key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	// not set, the key is not encrypted
+	t.Setenv("TEST_KEY_PASSPHRASE", "")
+
+	_, err = provider.WriteKey(key)
+	require.NoError(t, err)
+
+	_, err = client.NewKeyProviderWithStore(store).ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	t.Setenv("TEST_KEY_PASSPHRASE", "secret")
+
+	_, err = provider.WriteKey(key)
+	require.NoError(t, err)
+
+	_, err = client.NewKeyProviderWithStore(store).ReadValidKey("testapp", "john@example.com")
+	require.ErrorContains(t, err, "private key is locked")
+
+	_, err = provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+}
@@ -6,15 +6,11 @@ package client
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"runtime"
 	"time"
 
 	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
-	"github.com/adrg/xdg"
 
-	"github.com/siderolabs/go-api-signature/pkg/fileutils"
 	"github.com/siderolabs/go-api-signature/pkg/pgp"
 )
 
@@ -24,60 +20,78 @@ const (
 
 // KeyProvider handles loading/saving client keys.
 type KeyProvider struct {
-	// dataFileDirectory is the directory where keys are stored while XDG_DATA_HOME is used as base directory.
-	dataFileDirectory string
-	// customDataFileDirectory is the directory where keys are stored if custom option is preferred over XDG.
-	customDataFileDirectory string
-	// customBaseDirectory is the base directory to use if custom option is preferred over XDG.
-	customBaseDirectory string
-	keyLifetime         time.Duration
-	withFallback        bool
-	preferCustomOverXDG bool
+	store         KeyStore
+	passphrase    PassphraseFunc
+	keyLifetime   time.Duration
+	autoMigration bool
 }
 
-// NewKeyProvider creates a new KeyProvider.
-func NewKeyProvider(dataFileDirectory string) *KeyProvider {
-	return &KeyProvider{
-		dataFileDirectory:       dataFileDirectory,
-		keyLifetime:             keyLifetime,
-		customDataFileDirectory: dataFileDirectory,
-		customBaseDirectory:     xdg.DataHome,
-		preferCustomOverXDG:     false,
-		withFallback:            false,
+// KeyProviderOption is a functional option for the KeyProvider.
+type KeyProviderOption func(*KeyProvider)
+
+// WithPassphrase encrypts the private keys at rest with the passphrase returned by the given function.
+//
+// The keys are locked with the passphrase on write and unlocked on read.
+// If the passphrase is empty, the keys are written unencrypted.
+func WithPassphrase(passphrase PassphraseFunc) KeyProviderOption {
+	return func(provider *KeyProvider) {
+		provider.passphrase = passphrase
 	}
 }
 
+// NewKeyProvider creates a new KeyProvider.
+func NewKeyProvider(dataFileDirectory string, opts ...KeyProviderOption) *KeyProvider {
+	return NewKeyProviderWithStore(NewFileKeyStore(dataFileDirectory), opts...)
+}
+
 // NewKeyProviderWithFallback creates a new KeyProvider with fallback option to a custom directory over XDG.
-func NewKeyProviderWithFallback(dataFileDirectory, customBaseDirectory, customDataFileDirectory string, preferCustomOverXDG bool) *KeyProvider {
-	return &KeyProvider{
-		dataFileDirectory:       dataFileDirectory,
-		keyLifetime:             keyLifetime,
-		customBaseDirectory:     customBaseDirectory,
-		customDataFileDirectory: customDataFileDirectory,
-		preferCustomOverXDG:     preferCustomOverXDG,
-		withFallback:            true,
+func NewKeyProviderWithFallback(dataFileDirectory, customBaseDirectory, customDataFileDirectory string, preferCustomOverXDG bool,
+	opts ...KeyProviderOption,
+) *KeyProvider {
+	return NewKeyProviderWithStore(NewFileKeyStoreWithFallback(dataFileDirectory, customBaseDirectory, customDataFileDirectory, preferCustomOverXDG), opts...)
+}
+
+// NewKeyProviderWithStore creates a new KeyProvider with a custom KeyStore.
+func NewKeyProviderWithStore(store KeyStore, opts ...KeyProviderOption) *KeyProvider {
+	provider := &KeyProvider{
+		store:       store,
+		keyLifetime: keyLifetime,
+	}
+
+	for _, opt := range opts {
+		opt(provider)
 	}
+
+	return provider
 }
 
-// ReadValidKey reads a PGP key from the filesystem.
+// ReadValidKey reads a PGP key from the KeyStore.
 //
 // If the key is missing or invalid (e.g., expired, revoked), an error will be returned.
+// Locked keys are unlocked with the passphrase, see WithPassphrase.
 func (provider *KeyProvider) ReadValidKey(context, email string) (*Key, error) {
-	keyPath, err := provider.getKeyFilePath(context, email, READ)
+	provider.autoMigrateKey(context, email)
+
+	return provider.readValidKey(context, email)
+}
+
+// readValidKey is ReadValidKey without the automatic migration, which takes the key lock.
+func (provider *KeyProvider) readValidKey(context, email string) (*Key, error) {
+	key, err := provider.readKey(context, email)
 	if err != nil {
 		return nil, err
 	}
 
-	keyF, err := os.Open(keyPath)
+	locked, err := key.IsLocked()
 	if err != nil {
 		return nil, err
 	}
 
-	defer keyF.Close() //nolint:errcheck
-
-	key, err := pgpcrypto.NewKeyFromArmoredReader(keyF)
-	if err != nil {
-		return nil, err
+	if locked {
+		key, err = provider.unlockKey(key, context, email)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	pgpKey, err := pgp.NewKey(key)
@@ -123,93 +137,77 @@ func (provider *KeyProvider) GenerateKey(context, email, clientNameWithVersion s
 	}, nil
 }
 
-// DeleteKey deletes the key pair from disk.
+// DeleteKey deletes the key pair from the KeyStore.
 func (provider *KeyProvider) DeleteKey(context, email string) error {
-	keyPath, err := provider.getKeyFilePath(context, email, DELETE)
-	if err != nil {
-		return err
-	}
-
-	return os.Remove(keyPath)
+	return provider.store.Delete(context, email)
 }
 
-// WriteKey saves the key pair to disk and returns the save path.
+// WriteKey saves the key pair to the KeyStore and returns the save location.
+//
+// The private key is locked with the passphrase, see WithPassphrase.
+// The written key is read back and validated, and the replaced key is restored if the validation fails, see KeyBackuper.
 func (provider *KeyProvider) WriteKey(c *Key) (string, error) {
-	armored, err := c.Armor()
+	armored, err := provider.armorKey(c)
 	if err != nil {
 		return "", err
 	}
 
-	keyPath, err := provider.getKeyFilePath(c.context, c.identity, WRITE)
-	if err != nil {
-		return "", err
+	return provider.writeKey(c.context, c.identity, []byte(armored), c.Fingerprint())
+}
+
+// armorKey armors the key, locking the private key with the passphrase if it is set.
+func (provider *KeyProvider) armorKey(c *Key) (string, error) {
+	if provider.passphrase == nil {
+		return c.Armor()
 	}
 
-	err = os.WriteFile(keyPath, []byte(armored), 0o600)
+	passphrase, err := provider.passphrase(c.context, c.identity)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("failed to get the key passphrase: %w", err)
 	}
 
-	return keyPath, err
-}
-
-type accessType int32
-
-const (
-	READ accessType = iota
-	WRITE
-	DELETE
-)
-
-func (provider *KeyProvider) getKeyFilePath(context, identity string, access accessType) (string, error) {
-	keyName := fmt.Sprintf("%s-%s.pgp", context, identity)
-
-	if !provider.withFallback {
-		if !provider.preferCustomOverXDG {
-			return xdg.DataFile(filepath.Join(provider.dataFileDirectory, keyName))
-		}
-
-		return provider.ensureCustomPath(keyName)
+	if len(passphrase) == 0 {
+		return c.Armor()
 	}
 
-	// For Read and Delete operations, regardless of preferred location, if using primary location will result in
-	// failure, then use secondary location. If fallback doesn't succeed, then fail using primary location.
-	//
-	// For Write operation, if preferred location is Custom, do not fall back to XDG upon failure.
-	if access == READ || access == DELETE {
-		xdgExists := fileutils.FileExists(filepath.Join(xdg.DataHome, provider.dataFileDirectory, keyName))
-		customExists := fileutils.FileExists(filepath.Join(provider.customBaseDirectory, provider.customDataFileDirectory, keyName))
-
-		if !provider.preferCustomOverXDG {
-			if !xdgExists && customExists {
-				return provider.ensureCustomPath(keyName)
-			}
+	return c.ArmorLocked(passphrase)
+}
 
-			return xdg.DataFile(filepath.Join(provider.dataFileDirectory, keyName))
-		}
+// unlockKey unlocks the private key with the passphrase.
+//
+// The public key is validated first, so that the passphrase is not requested for the keys which are invalid anyway.
+func (provider *KeyProvider) unlockKey(key *pgpcrypto.Key, context, email string) (*pgpcrypto.Key, error) {
+	publicKey, err := key.ToPublic()
+	if err != nil {
+		return nil, err
+	}
 
-		if xdgExists && !customExists {
-			return xdg.DataFile(filepath.Join(provider.dataFileDirectory, keyName))
-		}
+	pgpPublicKey, err := pgp.NewKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
 
-		return provider.ensureCustomPath(keyName)
+	if err = pgpPublicKey.Validate(); err != nil {
+		return nil, err
 	}
 
-	if !provider.preferCustomOverXDG && fileutils.IsWritable(filepath.Join(xdg.DataHome, provider.dataFileDirectory)) {
-		return xdg.DataFile(filepath.Join(provider.dataFileDirectory, keyName))
+	if provider.passphrase == nil {
+		return nil, fmt.Errorf("private key is locked")
 	}
 
-	return provider.ensureCustomPath(keyName)
-}
+	passphrase, err := provider.passphrase(context, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the key passphrase: %w", err)
+	}
 
-func (provider *KeyProvider) ensureCustomPath(keyName string) (string, error) {
-	basePath := filepath.Join(provider.customBaseDirectory, provider.customDataFileDirectory)
-	fullPath := filepath.Join(basePath, keyName)
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("private key is locked")
+	}
 
-	err := os.MkdirAll(basePath, os.ModeDir|0o700)
+	unlocked, err := key.Unlock(passphrase)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("failed to unlock private key: %w", err)
 	}
 
-	return fullPath, nil
+	return unlocked, nil
 }
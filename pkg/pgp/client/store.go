@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import "context"
+
+// KeyStore stores the armored client keys by context and identity.
+type KeyStore interface {
+	// Read returns the armored key for the given context and identity.
+	//
+	// If the key is missing, an error matching os.IsNotExist is returned.
+	Read(context, identity string) ([]byte, error)
+
+	// Write saves the armored key for the given context and identity and returns its location.
+	Write(context, identity string, armored []byte) (string, error)
+
+	// Delete deletes the key for the given context and identity.
+	//
+	// If the key is missing, an error matching os.IsNotExist is returned.
+	Delete(context, identity string) error
+
+	// List returns the keys in the store.
+	List() ([]KeyStoreEntry, error)
+
+	// ReadEntry returns the armored key for the entry returned by List.
+	ReadEntry(entry KeyStoreEntry) ([]byte, error)
+
+	// DeleteEntry deletes the key for the entry returned by List.
+	DeleteEntry(entry KeyStoreEntry) error
+}
+
+// KeyLocker is implemented by the key stores which support the cross-process key locks, see KeyProvider.LockKey.
+type KeyLocker interface {
+	// Lock acquires the lock of the key for the given context and identity, and returns the function to release it.
+	Lock(ctx context.Context, contextName, identity string) (func() error, error)
+}
+
+// KeyMigrator is implemented by the key stores which might keep the same key in multiple locations, see KeyProvider.MigrateKeys.
+type KeyMigrator interface {
+	// PreferredLocation returns the location where the key for the given context and identity is written.
+	PreferredLocation(context, identity string) (string, error)
+}
+
+// KeyBackuper is implemented by the key stores which keep a backup of the key replaced on Write, see KeyProvider.WriteKey.
+//
+// The backup is kept until the written key is verified, so that the previous key can be recovered if the written key is unusable.
+type KeyBackuper interface {
+	// ReadBackup returns the armored backup of the key for the given context and identity.
+	//
+	// If there is no backup, an error matching os.IsNotExist is returned.
+	ReadBackup(context, identity string) ([]byte, error)
+
+	// RestoreBackup replaces the key for the given context and identity with its backup.
+	RestoreBackup(context, identity string) error
+
+	// RemoveBackup removes the backup of the key for the given context and identity, if there is one.
+	RemoveBackup(context, identity string) error
+}
+
+// KeyStoreEntry describes a key in the KeyStore.
+type KeyStoreEntry struct {
+	Context  string
+	Identity string
+
+	// Location is the store specific location of the key, e.g. the file path.
+	Location string
+}
@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	pgpcrypto "github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// EncryptedKeyStore is a KeyStore which encrypts the keys with a passphrase before passing them to the underlying store.
+//
+// Wrapping a FileKeyStore stores the keys in passphrase-encrypted files.
+type EncryptedKeyStore struct {
+	store      KeyStore
+	passphrase []byte
+}
+
+// NewEncryptedKeyStore creates a new EncryptedKeyStore on top of the given store.
+func NewEncryptedKeyStore(store KeyStore, passphrase []byte) *EncryptedKeyStore {
+	return &EncryptedKeyStore{
+		store:      store,
+		passphrase: passphrase,
+	}
+}
+
+// Read implements KeyStore.
+func (store *EncryptedKeyStore) Read(context, identity string) ([]byte, error) {
+	encrypted, err := store.store.Read(context, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decrypt(encrypted)
+}
+
+// ReadEntry implements KeyStore.
+func (store *EncryptedKeyStore) ReadEntry(entry KeyStoreEntry) ([]byte, error) {
+	encrypted, err := store.store.ReadEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decrypt(encrypted)
+}
+
+func (store *EncryptedKeyStore) decrypt(encrypted []byte) ([]byte, error) {
+	message, err := pgpcrypto.NewPGPMessageFromArmored(string(encrypted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encrypted key: %w", err)
+	}
+
+	decrypted, err := pgpcrypto.DecryptMessageWithPassword(message, store.passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return decrypted.GetBinary(), nil
+}
+
+// Write implements KeyStore.
+func (store *EncryptedKeyStore) Write(context, identity string, armored []byte) (string, error) {
+	message, err := pgpcrypto.EncryptMessageWithPassword(pgpcrypto.NewPlainMessage(armored), store.passphrase)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt key: %w", err)
+	}
+
+	encrypted, err := message.GetArmored()
+	if err != nil {
+		return "", err
+	}
+
+	return store.store.Write(context, identity, []byte(encrypted))
+}
+
+// Delete implements KeyStore.
+func (store *EncryptedKeyStore) Delete(context, identity string) error {
+	return store.store.Delete(context, identity)
+}
+
+// List implements KeyStore.
+func (store *EncryptedKeyStore) List() ([]KeyStoreEntry, error) {
+	return store.store.List()
+}
+
+// DeleteEntry implements KeyStore.
+func (store *EncryptedKeyStore) DeleteEntry(entry KeyStoreEntry) error {
+	return store.store.DeleteEntry(entry)
+}
+
+// PreferredLocation implements KeyMigrator if the underlying store implements it.
+//
+// If the underlying store doesn't implement KeyMigrator, an empty location is returned.
+func (store *EncryptedKeyStore) PreferredLocation(context, identity string) (string, error) {
+	migrator, ok := store.store.(KeyMigrator)
+	if !ok {
+		return "", nil
+	}
+
+	return migrator.PreferredLocation(context, identity)
+}
+
+// Lock implements KeyLocker if the underlying store implements it.
+func (store *EncryptedKeyStore) Lock(ctx context.Context, contextName, identity string) (func() error, error) {
+	return lockKey(ctx, store.store, contextName, identity)
+}
+
+// ReadBackup implements KeyBackuper if the underlying store implements it.
+func (store *EncryptedKeyStore) ReadBackup(context, identity string) ([]byte, error) {
+	backuper, ok := store.store.(KeyBackuper)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	encrypted, err := backuper.ReadBackup(context, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.decrypt(encrypted)
+}
+
+// RestoreBackup implements KeyBackuper if the underlying store implements it.
+func (store *EncryptedKeyStore) RestoreBackup(context, identity string) error {
+	backuper, ok := store.store.(KeyBackuper)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	return backuper.RestoreBackup(context, identity)
+}
+
+// RemoveBackup implements KeyBackuper if the underlying store implements it.
+func (store *EncryptedKeyStore) RemoveBackup(context, identity string) error {
+	backuper, ok := store.store.(KeyBackuper)
+	if !ok {
+		return nil
+	}
+
+	return backuper.RemoveBackup(context, identity)
+}
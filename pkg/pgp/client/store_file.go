@@ -0,0 +1,419 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/adrg/xdg"
+
+	"github.com/siderolabs/go-api-signature/pkg/fileutils"
+)
+
+// FileKeyStore is the default KeyStore, which stores the keys as armored files in XDG or custom directories.
+//
+// The keys are stored as "<context>-<identity>.pgp" files, see keyFileName.
+type FileKeyStore struct {
+	// dataFileDirectory is the directory where keys are stored while XDG_DATA_HOME is used as base directory.
+	dataFileDirectory string
+	// customDataFileDirectory is the directory where keys are stored if custom option is preferred over XDG.
+	customDataFileDirectory string
+	// customBaseDirectory is the base directory to use if custom option is preferred over XDG.
+	customBaseDirectory string
+	withFallback        bool
+	preferCustomOverXDG bool
+}
+
+// NewFileKeyStore creates a new FileKeyStore storing the keys in the XDG data directory.
+func NewFileKeyStore(dataFileDirectory string) *FileKeyStore {
+	return &FileKeyStore{
+		dataFileDirectory:       dataFileDirectory,
+		customDataFileDirectory: dataFileDirectory,
+		customBaseDirectory:     xdg.DataHome,
+		preferCustomOverXDG:     false,
+		withFallback:            false,
+	}
+}
+
+// NewFileKeyStoreWithFallback creates a new FileKeyStore with fallback option to a custom directory over XDG.
+func NewFileKeyStoreWithFallback(dataFileDirectory, customBaseDirectory, customDataFileDirectory string, preferCustomOverXDG bool) *FileKeyStore {
+	return &FileKeyStore{
+		dataFileDirectory:       dataFileDirectory,
+		customBaseDirectory:     customBaseDirectory,
+		customDataFileDirectory: customDataFileDirectory,
+		preferCustomOverXDG:     preferCustomOverXDG,
+		withFallback:            true,
+	}
+}
+
+// Read implements KeyStore.
+func (store *FileKeyStore) Read(context, identity string) ([]byte, error) {
+	keyPath, err := store.getKeyFilePath(context, identity, READ)
+	if err != nil {
+		return nil, err
+	}
+
+	return readKeyFile(keyPath)
+}
+
+// Write implements KeyStore.
+func (store *FileKeyStore) Write(context, identity string, armored []byte) (string, error) {
+	keyPath, err := store.getKeyFilePath(context, identity, WRITE)
+	if err != nil {
+		return "", err
+	}
+
+	if err = checkPrivate(filepath.Dir(keyPath)); err != nil {
+		return "", err
+	}
+
+	if err = writeKeyFile(keyPath, armored); err != nil {
+		return "", err
+	}
+
+	if err = store.removeLegacyKeyFiles(context, identity); err != nil {
+		return "", err
+	}
+
+	return keyPath, nil
+}
+
+// ReadBackup implements KeyBackuper.
+func (store *FileKeyStore) ReadBackup(context, identity string) ([]byte, error) {
+	keyPath, err := store.getKeyFilePath(context, identity, WRITE)
+	if err != nil {
+		return nil, err
+	}
+
+	return readKeyFile(backupKeyFilePath(keyPath))
+}
+
+// RestoreBackup implements KeyBackuper.
+func (store *FileKeyStore) RestoreBackup(context, identity string) error {
+	keyPath, err := store.getKeyFilePath(context, identity, WRITE)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(backupKeyFilePath(keyPath), keyPath); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(keyPath))
+}
+
+// RemoveBackup implements KeyBackuper.
+func (store *FileKeyStore) RemoveBackup(context, identity string) error {
+	keyPath, err := store.getKeyFilePath(context, identity, WRITE)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(backupKeyFilePath(keyPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Delete implements KeyStore.
+func (store *FileKeyStore) Delete(context, identity string) error {
+	keyPath, err := store.getKeyFilePath(context, identity, DELETE)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(keyPath)
+}
+
+// List implements KeyStore.
+//
+// Both XDG and custom directories are listed if the fallback is enabled, so the same key might be listed twice.
+func (store *FileKeyStore) List() ([]KeyStoreEntry, error) {
+	var entries []KeyStoreEntry
+
+	for _, dir := range store.directories() {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+
+			context, identity, ok := parseKeyFileName(file.Name())
+			if !ok {
+				continue
+			}
+
+			entries = append(entries, KeyStoreEntry{
+				Context:  context,
+				Identity: identity,
+				Location: filepath.Join(dir, file.Name()),
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+// PreferredLocation implements KeyMigrator.
+func (store *FileKeyStore) PreferredLocation(context, identity string) (string, error) {
+	return store.getKeyFilePath(context, identity, WRITE)
+}
+
+// ReadEntry implements KeyStore.
+func (store *FileKeyStore) ReadEntry(entry KeyStoreEntry) ([]byte, error) {
+	if err := store.checkEntry(entry); err != nil {
+		return nil, err
+	}
+
+	return readKeyFile(entry.Location)
+}
+
+// DeleteEntry implements KeyStore.
+func (store *FileKeyStore) DeleteEntry(entry KeyStoreEntry) error {
+	if err := store.checkEntry(entry); err != nil {
+		return err
+	}
+
+	return os.Remove(entry.Location)
+}
+
+// checkEntry checks that the entry location is a key file in one of the store directories.
+func (store *FileKeyStore) checkEntry(entry KeyStoreEntry) error {
+	if !slices.Contains(store.directories(), filepath.Dir(entry.Location)) || !strings.HasSuffix(entry.Location, keyFileExtension) {
+		return fmt.Errorf("key location is outside of the key directories: %s", entry.Location)
+	}
+
+	return nil
+}
+
+// directories returns the directories where the keys might be stored.
+func (store *FileKeyStore) directories() []string {
+	xdgDir := filepath.Join(xdg.DataHome, store.dataFileDirectory)
+	customDir := filepath.Join(store.customBaseDirectory, store.customDataFileDirectory)
+
+	switch {
+	case store.withFallback && store.preferCustomOverXDG:
+		return []string{customDir, xdgDir}
+	case store.withFallback:
+		return []string{xdgDir, customDir}
+	case store.preferCustomOverXDG:
+		return []string{customDir}
+	default:
+		return []string{xdgDir}
+	}
+}
+
+type accessType int32
+
+const (
+	READ accessType = iota
+	WRITE
+	DELETE
+)
+
+func (store *FileKeyStore) getKeyFilePath(context, identity string, access accessType) (string, error) {
+	keyName, err := keyFileName(context, identity)
+	if err != nil {
+		return "", err
+	}
+
+	if access != WRITE {
+		keyName = store.resolveLegacyKeyName(keyName, legacyKeyFileName(context, identity))
+	}
+
+	if !store.withFallback {
+		if !store.preferCustomOverXDG {
+			return xdg.DataFile(filepath.Join(store.dataFileDirectory, keyName))
+		}
+
+		return store.ensureCustomPath(keyName)
+	}
+
+	// For Read and Delete operations, regardless of preferred location, if using primary location will result in
+	// failure, then use secondary location. If fallback doesn't succeed, then fail using primary location.
+	//
+	// For Write operation, if preferred location is Custom, do not fall back to XDG upon failure.
+	if access == READ || access == DELETE {
+		xdgExists := fileutils.FileExists(filepath.Join(xdg.DataHome, store.dataFileDirectory, keyName))
+		customExists := fileutils.FileExists(filepath.Join(store.customBaseDirectory, store.customDataFileDirectory, keyName))
+
+		if !store.preferCustomOverXDG {
+			if !xdgExists && customExists {
+				return store.ensureCustomPath(keyName)
+			}
+
+			return xdg.DataFile(filepath.Join(store.dataFileDirectory, keyName))
+		}
+
+		if xdgExists && !customExists {
+			return xdg.DataFile(filepath.Join(store.dataFileDirectory, keyName))
+		}
+
+		return store.ensureCustomPath(keyName)
+	}
+
+	if !store.preferCustomOverXDG && fileutils.IsWritable(filepath.Join(xdg.DataHome, store.dataFileDirectory)) {
+		return xdg.DataFile(filepath.Join(store.dataFileDirectory, keyName))
+	}
+
+	return store.ensureCustomPath(keyName)
+}
+
+// resolveLegacyKeyName returns the legacy key file name if only the legacy key file exists.
+func (store *FileKeyStore) resolveLegacyKeyName(keyName, legacyKeyName string) string {
+	if legacyKeyName == keyName {
+		return keyName
+	}
+
+	dirs := store.directories()
+
+	for _, dir := range dirs {
+		if fileutils.FileExists(filepath.Join(dir, keyName)) {
+			return keyName
+		}
+	}
+
+	for _, dir := range dirs {
+		if fileutils.FileExists(filepath.Join(dir, legacyKeyName)) {
+			return legacyKeyName
+		}
+	}
+
+	return keyName
+}
+
+// removeLegacyKeyFiles removes the legacy key files replaced by the key file with the escaped name.
+func (store *FileKeyStore) removeLegacyKeyFiles(context, identity string) error {
+	keyName, err := keyFileName(context, identity)
+	if err != nil {
+		return err
+	}
+
+	legacyKeyName := legacyKeyFileName(context, identity)
+	if legacyKeyName == keyName {
+		return nil
+	}
+
+	for _, dir := range store.directories() {
+		if err = os.Remove(filepath.Join(dir, legacyKeyName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readKeyFile reads the key file after verifying that it is private, see checkPrivate.
+func readKeyFile(keyPath string) ([]byte, error) {
+	for _, path := range []string{filepath.Dir(keyPath), keyPath} {
+		if err := checkPrivate(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return os.ReadFile(keyPath)
+}
+
+// backupKeyFilePath returns the path of the backup of the key file replaced by writeKeyFile.
+func backupKeyFilePath(keyPath string) string {
+	return keyPath + ".bak"
+}
+
+// writeKeyFile writes the key file atomically: the data is written to a temporary file, synced and renamed over the key file.
+//
+// The previous key file is copied to the backup, see backupKeyFilePath.
+// The backup is not removed, as the written key is verified by the KeyProvider, see KeyBackuper.
+func writeKeyFile(keyPath string, data []byte) error {
+	dir := filepath.Dir(keyPath)
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(keyPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close() //nolint:errcheck
+
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close() //nolint:errcheck
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	previous, err := os.ReadFile(keyPath)
+
+	switch {
+	case err == nil:
+		if err = writeBackupFile(backupKeyFilePath(keyPath), previous); err != nil {
+			return fmt.Errorf("failed to back up the key file: %w", err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	if err = os.Rename(tmp.Name(), keyPath); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// writeBackupFile writes and syncs the backup of the key file.
+func writeBackupFile(backupPath string, data []byte) error {
+	f, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		f.Close() //nolint:errcheck
+
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close() //nolint:errcheck
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func (store *FileKeyStore) ensureCustomPath(keyName string) (string, error) {
+	basePath := filepath.Join(store.customBaseDirectory, store.customDataFileDirectory)
+	fullPath := filepath.Join(basePath, keyName)
+
+	err := os.MkdirAll(basePath, os.ModeDir|0o700)
+	if err != nil {
+		return "", err
+	}
+
+	return fullPath, nil
+}
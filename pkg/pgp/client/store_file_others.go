@@ -0,0 +1,21 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build !unix
+
+package client
+
+import "os"
+
+func checkPrivate(path string) error {
+	// The permission bits are not meaningful on this platform, only check that the path exists.
+	_, err := os.Stat(path)
+
+	return err
+}
+
+func syncDir(string) error {
+	// Not implemented for this platform.
+	return nil
+}
@@ -0,0 +1,119 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build unix
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestFileKeyStoreWrite(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	dir := t.TempDir()
+	keysDir := filepath.Join(dir, "keys")
+	store := client.NewFileKeyStoreWithFallback("keys", dir, "keys", true)
+
+	assertFiles := func(t *testing.T, expected ...string) {
+		files, err := os.ReadDir(keysDir)
+		require.NoError(t, err)
+
+		names := make([]string, 0, len(files))
+
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+
+		assert.ElementsMatch(t, expected, names)
+	}
+
+	path, err := store.Write("testapp", "john@example.com", []byte("first"))
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the previous key is replaced, and kept as a backup
+	_, err = store.Write("testapp", "john@example.com", []byte("second"))
+	require.NoError(t, err)
+
+	assertFiles(t, "testapp-john@example.com.pgp", "testapp-john@example.com.pgp.bak")
+
+	data, err := store.Read("testapp", "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	data, err = store.ReadBackup("testapp", "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	require.NoError(t, store.RemoveBackup("testapp", "john@example.com"))
+	require.NoError(t, store.RemoveBackup("testapp", "john@example.com"))
+
+	assertFiles(t, "testapp-john@example.com.pgp")
+
+	_, err = store.ReadBackup("testapp", "john@example.com")
+	assert.True(t, os.IsNotExist(err))
+
+	// the backup is restored
+	_, err = store.Write("testapp", "john@example.com", []byte("third"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.RestoreBackup("testapp", "john@example.com"))
+
+	assertFiles(t, "testapp-john@example.com.pgp")
+
+	data, err = store.Read("testapp", "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// a temporary file left by an interrupted write is ignored
+	require.NoError(t, os.WriteFile(path+".123.tmp", []byte("seco"), 0o600))
+
+	data, err = store.Read("testapp", "john@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	entries, err := store.List()
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// loose permissions are refused, and not changed
+	require.NoError(t, os.Chmod(path, 0o644))
+
+	_, err = store.Read("testapp", "john@example.com")
+	assert.ErrorContains(t, err, "loose permissions")
+
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	require.NoError(t, os.Chmod(path, 0o600))
+	require.NoError(t, os.Chmod(keysDir, 0o755))
+
+	_, err = store.Read("testapp", "john@example.com")
+	assert.ErrorContains(t, err, "loose permissions")
+
+	_, err = store.Write("testapp", "john@example.com", []byte("fourth"))
+	assert.ErrorContains(t, err, "loose permissions")
+
+	info, err = os.Stat(keysDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+}
@@ -0,0 +1,40 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+//go:build unix
+
+package client
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkPrivate checks that the file or the directory is not accessible by the group and others.
+//
+// The permissions are not changed, the paths with loose permissions are refused.
+func checkPrivate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("refusing to use %s with loose permissions %s, it should not be accessible by the group and others", path, perm)
+	}
+
+	return nil
+}
+
+// syncDir syncs the directory, so that the renames in it are durable.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return f.Sync()
+}
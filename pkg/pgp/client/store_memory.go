@@ -0,0 +1,104 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryKeyStore is a KeyStore which keeps the keys in memory, e.g. for tests.
+type MemoryKeyStore struct {
+	keys map[KeyStoreEntry][]byte
+	lock sync.Mutex
+}
+
+// NewMemoryKeyStore creates a new MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		keys: map[KeyStoreEntry][]byte{},
+	}
+}
+
+// Read implements KeyStore.
+func (store *MemoryKeyStore) Read(context, identity string) ([]byte, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	entry := memoryKeyStoreEntry(context, identity)
+
+	armored, ok := store.keys[entry]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: entry.Location, Err: fs.ErrNotExist}
+	}
+
+	return slices.Clone(armored), nil
+}
+
+// Write implements KeyStore.
+func (store *MemoryKeyStore) Write(context, identity string, armored []byte) (string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	entry := memoryKeyStoreEntry(context, identity)
+
+	store.keys[entry] = slices.Clone(armored)
+
+	return entry.Location, nil
+}
+
+// Delete implements KeyStore.
+func (store *MemoryKeyStore) Delete(context, identity string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	entry := memoryKeyStoreEntry(context, identity)
+
+	if _, ok := store.keys[entry]; !ok {
+		return &fs.PathError{Op: "delete", Path: entry.Location, Err: fs.ErrNotExist}
+	}
+
+	delete(store.keys, entry)
+
+	return nil
+}
+
+// List implements KeyStore.
+func (store *MemoryKeyStore) List() ([]KeyStoreEntry, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	entries := make([]KeyStoreEntry, 0, len(store.keys))
+
+	for entry := range store.keys {
+		entries = append(entries, entry)
+	}
+
+	slices.SortFunc(entries, func(a, b KeyStoreEntry) int {
+		return strings.Compare(a.Location, b.Location)
+	})
+
+	return entries, nil
+}
+
+// ReadEntry implements KeyStore.
+func (store *MemoryKeyStore) ReadEntry(entry KeyStoreEntry) ([]byte, error) {
+	return store.Read(entry.Context, entry.Identity)
+}
+
+// DeleteEntry implements KeyStore.
+func (store *MemoryKeyStore) DeleteEntry(entry KeyStoreEntry) error {
+	return store.Delete(entry.Context, entry.Identity)
+}
+
+func memoryKeyStoreEntry(context, identity string) KeyStoreEntry {
+	return KeyStoreEntry{
+		Context:  context,
+		Identity: identity,
+		Location: "memory:" + encodeKeyName(context, identity),
+	}
+}
@@ -0,0 +1,122 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package client_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/pgp/client"
+)
+
+func TestKeyStore(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+
+	// fake XDG paths
+	t.Setenv("HOME", t.TempDir())
+	xdg.Reload()
+
+	for _, test := range []struct {
+		newStore func(t *testing.T) client.KeyStore
+		name     string
+	}{
+		{
+			name: "file",
+			newStore: func(t *testing.T) client.KeyStore {
+				return client.NewFileKeyStoreWithFallback("keys", t.TempDir(), "keys", true)
+			},
+		},
+		{
+			name: "memory",
+			newStore: func(*testing.T) client.KeyStore {
+				return client.NewMemoryKeyStore()
+			},
+		},
+		{
+			name: "encrypted",
+			newStore: func(*testing.T) client.KeyStore {
+				return client.NewEncryptedKeyStore(client.NewMemoryKeyStore(), []byte("secret"))
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			store := test.newStore(t)
+
+			_, err := store.Read("testapp", "john@example.com")
+			assert.True(t, os.IsNotExist(err))
+
+			assert.True(t, os.IsNotExist(store.Delete("testapp", "john@example.com")))
+
+			_, err = store.Write("testapp", "john@example.com", []byte("john"))
+			require.NoError(t, err)
+
+			_, err = store.Write("my-app", "jane@example.com", []byte("jane"))
+			require.NoError(t, err)
+
+			data, err := store.Read("testapp", "john@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, "john", string(data))
+
+			entries, err := store.List()
+			require.NoError(t, err)
+
+			identities := map[string]string{}
+
+			for _, entry := range entries {
+				identities[entry.Identity] = entry.Context
+
+				assert.NotEmpty(t, entry.Location)
+			}
+
+			assert.Equal(t, map[string]string{
+				"john@example.com": "testapp",
+				"jane@example.com": "my-app",
+			}, identities)
+
+			require.NoError(t, store.Delete("testapp", "john@example.com"))
+
+			_, err = store.Read("testapp", "john@example.com")
+			assert.True(t, os.IsNotExist(err))
+
+			entries, err = store.List()
+			require.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
+
+func TestEncryptedKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	fileStore := client.NewFileKeyStoreWithFallback("keys", dir, "keys", true)
+
+	provider := client.NewKeyProviderWithStore(client.NewEncryptedKeyStore(fileStore, []byte("secret")))
+
+	key, err := provider.GenerateKey("testapp", "john@example.com", "test")
+	require.NoError(t, err)
+
+	path, err := provider.WriteKey(key)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, "keys", "testapp-john@example.com.pgp"), path)
+
+	encrypted, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(encrypted), "BEGIN PGP MESSAGE")
+	assert.NotContains(t, string(encrypted), "PRIVATE KEY")
+
+	readKey, err := provider.ReadValidKey("testapp", "john@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, key.Fingerprint(), readKey.Fingerprint())
+
+	_, err = client.NewKeyProviderWithStore(client.NewEncryptedKeyStore(fileStore, []byte("wrong"))).ReadValidKey("testapp", "john@example.com")
+	assert.ErrorContains(t, err, "failed to decrypt key")
+}
@@ -54,6 +54,16 @@ func (p *Key) Fingerprint() string {
 	return p.key.GetFingerprint()
 }
 
+// Email returns the email address of the primary identity of the key.
+func (p *Key) Email() string {
+	identity := p.key.GetEntity().PrimaryIdentity()
+	if identity == nil || identity.UserId == nil {
+		return ""
+	}
+
+	return identity.UserId.Email
+}
+
 // Verify verifies the signature of the given data using the public key.
 func (p *Key) Verify(data, signature []byte) error {
 	message := pgpcrypto.NewPlainMessage(data)
@@ -102,6 +112,16 @@ func (p *Key) Armor() (string, error) {
 	return p.key.Armor()
 }
 
+// ArmorLocked returns the key in the armored format with the private key locked (encrypted) with the given passphrase.
+func (p *Key) ArmorLocked(passphrase []byte) (string, error) {
+	locked, err := p.key.Lock(passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	return locked.Armor()
+}
+
 // ArmorPublic returns only the public key in armored format.
 func (p *Key) ArmorPublic() (string, error) {
 	return p.key.GetArmoredPublicKey()
@@ -131,6 +151,41 @@ func (p *Key) IsExpired(clockSkew time.Duration) bool {
 	return expired(now.Add(clockSkew)) && expired(now.Add(-clockSkew))
 }
 
+// CreationTime returns the creation time of the primary key.
+func (p *Key) CreationTime() time.Time {
+	return p.key.GetEntity().PrimaryKey.CreationTime
+}
+
+// Expiration returns the time when the key expires, and false if the key never expires.
+//
+// The key expires when either the primary key or the user ID self-signature expires.
+func (p *Key) Expiration() (time.Time, bool) {
+	var (
+		expiration time.Time
+		expires    bool
+	)
+
+	i := p.key.GetEntity().PrimaryIdentity()
+
+	update := func(creationTime time.Time, lifetimeSecs *uint32) {
+		if lifetimeSecs == nil || *lifetimeSecs == 0 {
+			return
+		}
+
+		t := creationTime.Add(time.Duration(*lifetimeSecs) * time.Second)
+
+		if !expires || t.Before(expiration) {
+			expiration = t
+			expires = true
+		}
+	}
+
+	update(p.key.GetEntity().PrimaryKey.CreationTime, i.SelfSignature.KeyLifetimeSecs)
+	update(i.SelfSignature.CreationTime, i.SelfSignature.SigLifetimeSecs)
+
+	return expiration, expires
+}
+
 // generateEntity generates a new PGP entity.
 // Adapted from crypto.generateKey to be able to set the expiration.
 func generateEntity(name, comment, email string, lifetimeSecs uint32) (*openpgp.Entity, error) {
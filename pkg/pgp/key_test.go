@@ -39,6 +39,46 @@ func testKeyFlow(t *testing.T, key *pgp.Key) {
 	assert.Error(t, key.Verify(message, signature[:len(signature)-1]))
 }
 
+func TestExpiration(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+
+	key, err := pgp.GenerateKey("John Smith", "Linux", "john.smith@example.com", time.Hour)
+	require.NoError(t, err)
+
+	assert.WithinRange(t, key.CreationTime(), start, time.Now())
+
+	expiration, expires := key.Expiration()
+	require.True(t, expires)
+
+	assert.WithinRange(t, expiration, start.Add(time.Hour), time.Now().Add(time.Hour))
+}
+
+func TestArmorLocked(t *testing.T) {
+	key, err := pgp.GenerateKey("John Smith", "Linux", "john.smith@example.com", time.Hour)
+	require.NoError(t, err)
+
+	armored, err := key.ArmorLocked([]byte("secret"))
+	require.NoError(t, err)
+
+	lockedKey, err := pgpcrypto.NewKeyFromArmored(armored)
+	require.NoError(t, err)
+
+	locked, err := lockedKey.IsLocked()
+	require.NoError(t, err)
+	assert.True(t, locked)
+
+	_, err = lockedKey.Unlock([]byte("wrong"))
+	assert.Error(t, err)
+
+	unlockedKey, err := lockedKey.Unlock([]byte("secret"))
+	require.NoError(t, err)
+
+	key, err = pgp.NewKey(unlockedKey)
+	require.NoError(t, err)
+
+	testKeyFlow(t, key)
+}
+
 func TestTimeSkew(t *testing.T) {
 	start := time.Now()
 
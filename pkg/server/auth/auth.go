@@ -0,0 +1,47 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package auth contains the server-side helpers shared by the signature verification interceptors and middlewares.
+package auth
+
+import (
+	"context"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+)
+
+// KeyLookupFunc returns the verifier for the key with the given fingerprint which belongs to the given identity.
+//
+// It implements message.KeyResolver.
+type KeyLookupFunc func(ctx context.Context, identity, fingerprint string) (message.SignatureVerifier, error)
+
+// Resolve implements message.KeyResolver.
+func (f KeyLookupFunc) Resolve(ctx context.Context, identity, fingerprint string) (message.SignatureVerifier, error) {
+	return f(ctx, identity, fingerprint)
+}
+
+// Identity represents the verified identity of the request signer.
+type Identity struct {
+	// Name is the identity (e.g. the email address) the request was signed with.
+	Name string
+
+	// KeyFingerprint is the fingerprint of the key used to sign the request.
+	KeyFingerprint string
+}
+
+type identityContextKey struct{}
+
+// ContextWithIdentity returns a new context with the given verified identity attached.
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the verified identity attached to the context.
+//
+// The second return value is false if the request was not signed, e.g. if the signature was not required.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(*Identity)
+
+	return identity, ok
+}
@@ -0,0 +1,54 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package interceptor
+
+import (
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/mem"
+)
+
+// Codec returns the gRPC codec which captures the wire encoding of the received messages,
+// so that the message.SignatureVersionV2 signatures are verified against it, see message.GRPC.RequestData.
+//
+// It should be installed with grpc.ForceServerCodecV2 along with the interceptors of the same Interceptor,
+// as the captured encodings are only released by the interceptors.
+// Without the codec, the signatures are verified against the re-marshaled request messages.
+func (i *Interceptor) Codec() encoding.CodecV2 {
+	return &codec{
+		CodecV2:     encoding.GetCodecV2(proto.Name),
+		interceptor: i,
+	}
+}
+
+// codec wraps the proto codec to capture the wire encoding of the received messages.
+type codec struct {
+	encoding.CodecV2
+
+	interceptor *Interceptor
+}
+
+// Unmarshal implements encoding.CodecV2.
+func (c *codec) Unmarshal(data mem.BufferSlice, v any) error {
+	if err := c.CodecV2.Unmarshal(data, v); err != nil {
+		return err
+	}
+
+	c.interceptor.requestData.Store(v, data.Materialize())
+
+	return nil
+}
+
+// takeRequestData returns and releases the captured wire encoding of the received message, nil if it was not captured.
+func (i *Interceptor) takeRequestData(m any) []byte {
+	data, ok := i.requestData.LoadAndDelete(m)
+	if !ok {
+		return nil
+	}
+
+	raw, _ := data.([]byte) //nolint:errcheck
+
+	return raw
+}
@@ -0,0 +1,170 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package interceptor provides GRPC server interceptors that verify request signatures.
+package interceptor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/server/auth"
+)
+
+// Options are the options for the interceptor.
+type Options struct {
+	// KeyResolver is used to find the key which signed the request, e.g. auth.KeyLookupFunc.
+	KeyResolver message.KeyResolver
+
+	// MessageOptions are passed to message.NewGRPC, e.g. message.WithSignatureRequiredCheck.
+	MessageOptions []message.Option
+
+	// VerifyStreamMessages enables verification of each message received on the signed streams, see message.StreamVerifier.
+	//
+	// The clients must sign the stream messages, the messages without the signed envelope are rejected.
+	// If message.SignatureVersionV2 is required with message.WithRequiredSignatureVersion, the signed streams are rejected
+	// unless the stream messages are verified, as the stream signatures don't cover the request messages.
+	VerifyStreamMessages bool
+}
+
+// Interceptor is a GRPC interceptor that provides Unary and Stream server interceptors.
+type Interceptor struct {
+	// requestData is the wire encoding of the received messages captured by the Codec.
+	requestData sync.Map
+	options     Options
+}
+
+// New creates a new server interceptor.
+func New(options Options) *Interceptor {
+	return &Interceptor{
+		options: options,
+	}
+}
+
+// Unary returns a new unary server interceptor which verifies request signatures.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		protoReq, _ := req.(proto.Message) //nolint:errcheck
+
+		ctx, _, err := i.verify(ctx, info.FullMethod, protoReq, i.takeRequestData(req))
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a new streaming server interceptor which verifies request signatures.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, streamVerifier, err := i.verify(ss.Context(), info.FullMethod, nil, nil)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			verifier:     streamVerifier,
+			interceptor:  i,
+		})
+	}
+}
+
+// verify verifies the signature of the request and returns the context with the verified identity attached.
+//
+// The request message and its wire encoding are only available for the unary calls,
+// they are verified against the message.SignatureVersionV2 signatures.
+// If the signature is not present and not required for the method, the context is returned unchanged.
+// The stream message verifier is returned for the signed streams if the stream message verification is enabled.
+func (i *Interceptor) verify(ctx context.Context, method string, req proto.Message, reqData []byte) (context.Context, *message.StreamVerifier, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.New(nil)
+	}
+
+	msg := message.NewGRPC(md, method, i.options.MessageOptions...)
+	msg.Request = req
+	msg.RequestData = reqData
+
+	// only the missing signature is allowed to pass, e.g. a missing payload of the signed message is a verification failure
+	if _, err := msg.Signature(); err != nil {
+		if errors.Is(err, message.ErrNotFound) {
+			return ctx, nil, nil
+		}
+
+		return nil, nil, status.Errorf(codes.Unauthenticated, "invalid signature: %v", err)
+	}
+
+	signature, err := msg.VerifyWith(ctx, i.options.KeyResolver)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unauthenticated, "invalid signature: %v", err)
+	}
+
+	if req == nil && !i.options.VerifyStreamMessages && msg.Options.RequiredSignatureVersion == message.SignatureVersionV2 {
+		return nil, nil, status.Errorf(codes.Unauthenticated, "invalid signature: the stream messages are not covered by the signature")
+	}
+
+	var streamVerifier *message.StreamVerifier
+
+	if i.options.VerifyStreamMessages && req == nil {
+		streamVerifier, err = message.NewStreamVerifier(ctx, msg, signature, i.options.KeyResolver)
+		if err != nil {
+			return nil, nil, status.Errorf(codes.Unauthenticated, "invalid signature: %v", err)
+		}
+	}
+
+	return auth.ContextWithIdentity(ctx, &auth.Identity{
+		Name:           signature.Identity,
+		KeyFingerprint: signature.KeyFingerprint,
+	}), streamVerifier, nil
+}
+
+// serverStream wraps grpc.ServerStream to replace its context, and to verify the received messages.
+type serverStream struct {
+	grpc.ServerStream
+
+	ctx         context.Context //nolint:containedctx
+	verifier    *message.StreamVerifier
+	interceptor *Interceptor
+}
+
+// Context returns the context with the verified identity attached.
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// RecvMsg receives the message and verifies its signature if the stream message verification is enabled.
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	// the stream messages are covered by the stream envelopes, their wire encoding is not used
+	s.interceptor.takeRequestData(m)
+
+	if s.verifier == nil {
+		return nil
+	}
+
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "invalid signature: unsupported message type %T", m)
+	}
+
+	if err := s.verifier.Verify(msg); err != nil {
+		return status.Errorf(codes.Unauthenticated, "invalid signature: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,377 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package interceptor_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/status"
+
+	clientinterceptor "github.com/siderolabs/go-api-signature/pkg/client/interceptor"
+	"github.com/siderolabs/go-api-signature/pkg/internal/grpctest"
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+	"github.com/siderolabs/go-api-signature/pkg/server/auth"
+	"github.com/siderolabs/go-api-signature/pkg/server/interceptor"
+)
+
+const testIdentity = "test@example.org"
+
+type testServer struct {
+	grpc_testing.UnimplementedTestServiceServer
+}
+
+// UnaryCall responds with the verified identity, or "anonymous" if the request was not signed.
+func (s testServer) UnaryCall(ctx context.Context, _ *grpc_testing.SimpleRequest) (*grpc_testing.SimpleResponse, error) {
+	return &grpc_testing.SimpleResponse{
+		Payload: &grpc_testing.Payload{
+			Body: []byte(identityName(ctx)),
+		},
+	}, nil
+}
+
+func (s testServer) StreamingOutputCall(_ *grpc_testing.StreamingOutputCallRequest, stream grpc_testing.TestService_StreamingOutputCallServer) error {
+	return stream.Send(&grpc_testing.StreamingOutputCallResponse{
+		Payload: &grpc_testing.Payload{
+			Body: []byte(identityName(stream.Context())),
+		},
+	})
+}
+
+func identityName(ctx context.Context) string {
+	identity, ok := auth.IdentityFromContext(ctx)
+	if !ok {
+		return "anonymous"
+	}
+
+	return identity.Name
+}
+
+type VerificationTestSuite struct {
+	key *pgp.Key
+
+	grpctest.Suite
+
+	signatureRequired atomic.Bool
+	v2Required        atomic.Bool
+}
+
+func (suite *VerificationTestSuite) SetupSuite() {
+	var err error
+
+	suite.key, err = pgp.GenerateKey("test", "test", testIdentity, time.Hour)
+	suite.Require().NoError(err)
+
+	newInterceptor := func(opts ...message.Option) *interceptor.Interceptor {
+		return interceptor.New(interceptor.Options{
+			KeyResolver: auth.KeyLookupFunc(func(_ context.Context, identity, fingerprint string) (message.SignatureVerifier, error) {
+				if identity != testIdentity || fingerprint != suite.key.Fingerprint() {
+					return nil, errors.New("key not found")
+				}
+
+				return suite.key, nil
+			}),
+			MessageOptions: append([]message.Option{
+				message.WithSignatureRequiredCheck(func() (bool, error) {
+					return suite.signatureRequired.Load(), nil
+				}),
+			}, opts...),
+		})
+	}
+
+	serverInterceptor := newInterceptor()
+	streamInterceptor := serverInterceptor.Stream()
+	v2StreamInterceptor := newInterceptor(message.WithRequiredSignatureVersion(message.SignatureVersionV2)).Stream()
+
+	suite.InitServer(
+		grpc.ForceServerCodecV2(serverInterceptor.Codec()),
+		grpc.UnaryInterceptor(serverInterceptor.Unary()),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if suite.v2Required.Load() {
+				return v2StreamInterceptor(srv, ss, info, handler)
+			}
+
+			return streamInterceptor(srv, ss, info, handler)
+		}),
+	)
+
+	grpc_testing.RegisterTestServiceServer(suite.Server, testServer{})
+
+	suite.StartServer()
+}
+
+func (suite *VerificationTestSuite) TearDownSuite() {
+	suite.StopServer()
+}
+
+func (suite *VerificationTestSuite) SetupTest() {
+	suite.signatureRequired.Store(true)
+	suite.v2Required.Store(false)
+}
+
+func (suite *VerificationTestSuite) newClient(signer message.Signer, version message.SignatureVersion) grpc_testing.TestServiceClient {
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	if signer != nil {
+		clientInterceptor := clientinterceptor.New(clientinterceptor.Options{
+			GetUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+				return signer, nil
+			},
+			RenewUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+				return nil, status.Error(codes.Unauthenticated, "renewal is not supported")
+			},
+			Identity:         testIdentity,
+			SignatureVersion: version,
+		})
+
+		dialOptions = append(dialOptions,
+			grpc.WithUnaryInterceptor(clientInterceptor.Unary()),
+			grpc.WithStreamInterceptor(clientInterceptor.Stream()),
+		)
+	}
+
+	clientConn, err := grpc.NewClient(suite.Target, dialOptions...)
+	suite.Require().NoError(err)
+
+	suite.T().Cleanup(func() { clientConn.Close() }) //nolint:errcheck
+
+	return grpc_testing.NewTestServiceClient(clientConn)
+}
+
+func (suite *VerificationTestSuite) TestUnarySigned() {
+	response, err := suite.newClient(suite.key, message.SignatureVersionV1).UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{})
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(testIdentity, string(response.GetPayload().GetBody()))
+}
+
+func (suite *VerificationTestSuite) TestUnarySignedV2() {
+	response, err := suite.newClient(suite.key, message.SignatureVersionV2).UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{
+		Payload: &grpc_testing.Payload{
+			Body: []byte("signed body"),
+		},
+	})
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(testIdentity, string(response.GetPayload().GetBody()))
+}
+
+func (suite *VerificationTestSuite) TestUnaryUnknownKey() {
+	otherKey, err := pgp.GenerateKey("test", "test", testIdentity, time.Hour)
+	suite.Require().NoError(err)
+
+	_, err = suite.newClient(otherKey, message.SignatureVersionV1).UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{})
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *VerificationTestSuite) TestUnaryUnsigned() {
+	_, err := suite.newClient(nil, "").UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{})
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *VerificationTestSuite) TestUnaryUnsignedNotRequired() {
+	suite.signatureRequired.Store(false)
+
+	response, err := suite.newClient(nil, "").UnaryCall(suite.T().Context(), &grpc_testing.SimpleRequest{})
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal("anonymous", string(response.GetPayload().GetBody()))
+}
+
+func (suite *VerificationTestSuite) TestStreamSigned() {
+	stream, err := suite.newClient(suite.key, message.SignatureVersionV1).StreamingOutputCall(suite.T().Context(), &grpc_testing.StreamingOutputCallRequest{})
+	suite.Require().NoError(err)
+
+	response, err := stream.Recv()
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(testIdentity, string(response.GetPayload().GetBody()))
+}
+
+func (suite *VerificationTestSuite) TestStreamSignedV2() {
+	stream, err := suite.newClient(suite.key, message.SignatureVersionV2).StreamingOutputCall(suite.T().Context(), &grpc_testing.StreamingOutputCallRequest{})
+	suite.Require().NoError(err)
+
+	response, err := stream.Recv()
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(testIdentity, string(response.GetPayload().GetBody()))
+}
+
+func (suite *VerificationTestSuite) TestStreamUnsigned() {
+	stream, err := suite.newClient(nil, "").StreamingOutputCall(suite.T().Context(), &grpc_testing.StreamingOutputCallRequest{})
+	suite.Require().NoError(err)
+
+	_, err = stream.Recv()
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (suite *VerificationTestSuite) TestStreamV2Required() {
+	suite.v2Required.Store(true)
+
+	// the stream messages are not verified, so the signature doesn't cover them
+	stream, err := suite.newClient(suite.key, message.SignatureVersionV2).StreamingOutputCall(suite.T().Context(), &grpc_testing.StreamingOutputCallRequest{})
+	suite.Require().NoError(err)
+
+	_, err = stream.Recv()
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestVerificationTestSuite(t *testing.T) {
+	suite.Run(t, new(VerificationTestSuite))
+}
+
+type streamMessagesServer struct {
+	grpc_testing.UnimplementedTestServiceServer
+}
+
+// StreamingInputCall responds with the total size of the received payloads.
+func (s streamMessagesServer) StreamingInputCall(stream grpc_testing.TestService_StreamingInputCallServer) error {
+	var size int32
+
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&grpc_testing.StreamingInputCallResponse{
+				AggregatedPayloadSize: size,
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		size += int32(len(req.GetPayload().GetBody()))
+	}
+}
+
+type StreamMessagesTestSuite struct {
+	key      *pgp.Key
+	resolver *message.MemoryKeyResolver
+
+	grpctest.Suite
+}
+
+func (suite *StreamMessagesTestSuite) SetupSuite() {
+	var err error
+
+	suite.key, err = pgp.GenerateKey("test", "test", testIdentity, time.Hour)
+	suite.Require().NoError(err)
+
+	suite.resolver = message.NewMemoryKeyResolver()
+	suite.resolver.Add(testIdentity, suite.key.Fingerprint(), suite.key)
+
+	serverInterceptor := interceptor.New(interceptor.Options{
+		KeyResolver:          suite.resolver,
+		VerifyStreamMessages: true,
+	})
+
+	suite.InitServer(grpc.StreamInterceptor(serverInterceptor.Stream()))
+
+	grpc_testing.RegisterTestServiceServer(suite.Server, streamMessagesServer{})
+
+	suite.StartServer()
+}
+
+func (suite *StreamMessagesTestSuite) TearDownSuite() {
+	suite.StopServer()
+}
+
+func (suite *StreamMessagesTestSuite) streamingInputCall(signStreamMessages bool) (*grpc_testing.StreamingInputCallResponse, error) {
+	return suite.streamingInputCallWith(clientinterceptor.New(clientinterceptor.Options{
+		GetUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+			return suite.key, nil
+		},
+		RenewUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+			return nil, status.Error(codes.Unauthenticated, "renewal is not supported")
+		},
+		Identity:           testIdentity,
+		SignStreamMessages: signStreamMessages,
+	}))
+}
+
+func (suite *StreamMessagesTestSuite) streamingInputCallWith(clientInterceptor *clientinterceptor.Interceptor) (*grpc_testing.StreamingInputCallResponse, error) {
+	clientConn, err := grpc.NewClient(suite.Target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(clientInterceptor.Stream()),
+	)
+	suite.Require().NoError(err)
+
+	suite.T().Cleanup(func() { clientConn.Close() }) //nolint:errcheck
+
+	stream, err := grpc_testing.NewTestServiceClient(clientConn).StreamingInputCall(suite.T().Context())
+	suite.Require().NoError(err)
+
+	for _, body := range []string{"foo", "barbaz"} {
+		if err = stream.Send(&grpc_testing.StreamingInputCallRequest{
+			Payload: &grpc_testing.Payload{
+				Body: []byte(body),
+			},
+		}); err != nil {
+			break
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+func (suite *StreamMessagesTestSuite) TestSigned() {
+	response, err := suite.streamingInputCall(true)
+	suite.Require().NoError(err)
+
+	suite.Assert().EqualValues(9, response.GetAggregatedPayloadSize())
+}
+
+func (suite *StreamMessagesTestSuite) TestRenewedKey() {
+	var renewals int
+
+	// each signer lookup renews the key, as the renewed keys expire within RenewBeforeExpiry as well
+	response, err := suite.streamingInputCallWith(clientinterceptor.New(clientinterceptor.Options{
+		GetUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+			return suite.key, nil
+		},
+		RenewUserKeyFunc: func(context.Context, *grpc.ClientConn, *clientinterceptor.Options) (message.Signer, error) {
+			renewals++
+
+			key, err := pgp.GenerateKey("test", "test", testIdentity, time.Hour)
+			if err != nil {
+				return nil, err
+			}
+
+			suite.resolver.Add(testIdentity, key.Fingerprint(), key)
+
+			return key, nil
+		},
+		KeyExpiringFunc:    func(context.Context, message.Signer, time.Time) {},
+		Identity:           testIdentity,
+		RenewBeforeExpiry:  2 * time.Hour,
+		SignStreamMessages: true,
+	}))
+	suite.Require().NoError(err)
+
+	suite.Assert().EqualValues(9, response.GetAggregatedPayloadSize())
+	suite.Assert().Equal(1, renewals)
+}
+
+func (suite *StreamMessagesTestSuite) TestUnsignedMessages() {
+	_, err := suite.streamingInputCall(false)
+	suite.Assert().Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func TestStreamMessagesTestSuite(t *testing.T) {
+	suite.Run(t, new(StreamMessagesTestSuite))
+}
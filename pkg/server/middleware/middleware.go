@@ -0,0 +1,114 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package middleware provides an HTTP middleware that verifies request signatures.
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/server/auth"
+)
+
+// Options are the options for the middleware.
+type Options struct {
+	// KeyResolver is used to find the key which signed the request, e.g. auth.KeyLookupFunc.
+	KeyResolver message.KeyResolver
+
+	// MessageOptions are passed to message.NewHTTP, e.g. message.WithSignatureRequiredCheck.
+	MessageOptions []message.Option
+}
+
+// Handler is an http.Handler which verifies the request signature before passing the request to the next handler.
+//
+// The verified identity is attached to the request context, see auth.IdentityFromContext.
+type Handler struct {
+	next    http.Handler
+	options Options
+}
+
+// NewHandler creates a new signature verifying handler wrapping the given handler.
+func NewHandler(next http.Handler, options Options) *Handler {
+	return &Handler{
+		next:    next,
+		options: options,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	msg, err := message.NewHTTP(r, h.options.MessageOptions...)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if errors.Is(err, message.ErrBodyTooLarge) {
+			statusCode = http.StatusRequestEntityTooLarge
+		}
+
+		writeError(w, statusCode, fmt.Sprintf("failed to read request: %v", err))
+
+		return
+	}
+
+	if _, err = msg.Signature(); err != nil {
+		switch {
+		case errors.Is(err, message.ErrNotFound):
+			h.next.ServeHTTP(w, r)
+		case errors.Is(err, message.ErrInvalidSignature):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid signature header: %v", err))
+		}
+
+		return
+	}
+
+	signature, err := msg.VerifyWith(r.Context(), h.options.KeyResolver)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("invalid signature: %v", err))
+
+		return
+	}
+
+	ctx := auth.ContextWithIdentity(r.Context(), &auth.Identity{
+		Name:           signature.Identity,
+		KeyFingerprint: signature.KeyFingerprint,
+	})
+
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// errorBody is the JSON error response body.
+//
+// It follows the format of the grpc-gateway error responses.
+type errorBody struct {
+	Message string     `json:"message"`
+	Code    codes.Code `json:"code"`
+}
+
+func writeError(w http.ResponseWriter, statusCode int, msg string) {
+	var code codes.Code
+
+	switch statusCode {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusRequestEntityTooLarge:
+		code = codes.ResourceExhausted
+	default:
+		code = codes.Unauthenticated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(errorBody{ //nolint:errcheck,errchkjson
+		Code:    code,
+		Message: msg,
+	})
+}
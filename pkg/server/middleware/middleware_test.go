@@ -0,0 +1,164 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package middleware_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/siderolabs/go-api-signature/pkg/message"
+	"github.com/siderolabs/go-api-signature/pkg/pgp"
+	"github.com/siderolabs/go-api-signature/pkg/server/auth"
+	"github.com/siderolabs/go-api-signature/pkg/server/middleware"
+)
+
+func TestHandler(t *testing.T) {
+	const (
+		identity = "test@example.com"
+		body     = "hello world"
+	)
+
+	key, err := pgp.GenerateKey("test", "test", identity, time.Hour)
+	require.NoError(t, err)
+
+	otherKey, err := pgp.GenerateKey("test", "test", identity, time.Hour)
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody, readErr := io.ReadAll(r.Body)
+		assert.NoError(t, readErr)
+		assert.Equal(t, body, string(requestBody))
+
+		verified, ok := auth.IdentityFromContext(r.Context())
+		if !ok {
+			w.Write([]byte("anonymous")) //nolint:errcheck
+
+			return
+		}
+
+		w.Write([]byte(verified.Name)) //nolint:errcheck
+	})
+
+	resolver := message.NewMemoryKeyResolver()
+	resolver.Add(identity, key.Fingerprint(), key)
+
+	for _, tt := range []struct {
+		mutator           func(*testing.T, *http.Request)
+		name              string
+		expectedBody      string
+		signer            *pgp.Key
+		signOptions       []message.Option
+		expectedStatus    int
+		signatureOptional bool
+	}{
+		{
+			name:           "valid signature",
+			signer:         key,
+			expectedStatus: http.StatusOK,
+			expectedBody:   identity,
+		},
+		{
+			name:           "valid RFC 9421 signature",
+			signer:         key,
+			signOptions:    []message.Option{message.WithHTTPMessageSignatures(true)},
+			expectedStatus: http.StatusOK,
+			expectedBody:   identity,
+		},
+		{
+			name:           "unknown key",
+			signer:         otherKey,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "no signature",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:              "no signature - not required",
+			signatureOptional: true,
+			expectedStatus:    http.StatusOK,
+			expectedBody:      "anonymous",
+		},
+		{
+			name:   "malformed signature header",
+			signer: key,
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Header.Set(message.SignatureHeaderKey, "siderov0 foo bar baz") //nolint:canonicalheader
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "mutated method",
+			signer: key,
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Method = http.MethodPost
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "body too large",
+			signer: key,
+			mutator: func(_ *testing.T, req *http.Request) {
+				req.Body = io.NopCloser(strings.NewReader(strings.Repeat("a", message.DefaultMaxBodySize+1)))
+			},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/some/path", strings.NewReader(body))
+
+			if tt.signer != nil {
+				msg, msgErr := message.NewHTTP(req, tt.signOptions...)
+				require.NoError(t, msgErr)
+
+				require.NoError(t, msg.Sign(identity, tt.signer))
+			}
+
+			if tt.mutator != nil {
+				tt.mutator(t, req)
+			}
+
+			handler := middleware.NewHandler(next, middleware.Options{
+				KeyResolver: resolver,
+				MessageOptions: []message.Option{
+					message.WithSignatureRequiredCheck(func() (bool, error) {
+						return !tt.signatureOptional, nil
+					}),
+				},
+			})
+
+			recorder := httptest.NewRecorder()
+
+			handler.ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.expectedBody, recorder.Body.String())
+
+				return
+			}
+
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			var errorBody struct {
+				Message string `json:"message"`
+				Code    int    `json:"code"`
+			}
+
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errorBody))
+			assert.NotEmpty(t, errorBody.Message)
+			assert.NotZero(t, errorBody.Code)
+		})
+	}
+}